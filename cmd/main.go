@@ -1,11 +1,135 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"github.com/caasmo/kv-repl-barebones/repl"
 	"github.com/caasmo/kv-repl-barebones/storage"
+	"os"
 )
 
 func main() {
-	store := storage.NewStore()
-	repl.NewRepl(store).Run()
+	debug := flag.Bool("debug", false, "log transaction transitions to stderr")
+	strict := flag.Bool("strict", false, "abort at the first error with exit code 1")
+	version := flag.Bool("version", false, "print the version and exit")
+	ack := flag.Bool("ack", false, "print OK for the successful commands without output")
+	check := flag.Bool("check", false, "only parse the script, reporting the invalid lines, without executing it")
+	echo := flag.Bool("echo", false, "print each input line before executing it")
+	safe := flag.Bool("safe", false, "ask for confirmation before destructive commands like restore")
+	color := flag.Bool("color", false, "print errors in red when the output is a terminal")
+	initFile := flag.String("init", "", "run the commands of the `file` before the input")
+	baseDir := flag.String("base-dir", "", "resolve the relative paths of source against `dir`")
+	txRequired := flag.Bool("tx-required", false, "reject mutations outside a transaction")
+	noShadowing := flag.Bool("no-shadowing", false, "reject a second write or remove of a key in the same transaction")
+	maxKeys := flag.Int("max-keys", 0, "maximum number of keys, 0 for unlimited")
+	evictLRU := flag.Bool("evict-lru", false, "evict the least recently used key over --max-keys instead of failing")
+	separator := flag.String("separator", ":", "`separator` of the levels of hierarchical keys")
+	audit := flag.Bool("audit", false, "record the committed operations for readat")
+	aof := flag.String("aof", "", "persist committed operations to the append-only `file`")
+	aofSync := flag.String("aof-sync", "everysec", "sync `policy` of the append-only file: always, everysec or no")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [script]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *version {
+		fmt.Println(repl.Version())
+		return
+	}
+
+	opts := []storage.Option{storage.WithSeparator(*separator)}
+	if *debug {
+		opts = append(opts, storage.WithDebug(os.Stderr))
+	}
+
+	if *txRequired {
+		opts = append(opts, storage.WithTxRequired())
+	}
+
+	if *noShadowing {
+		opts = append(opts, storage.WithNoShadowing())
+	}
+
+	if *audit {
+		opts = append(opts, storage.WithAuditLog())
+	}
+
+	if *maxKeys > 0 {
+		opts = append(opts, storage.WithMaxKeys(*maxKeys))
+	}
+
+	if *evictLRU {
+		opts = append(opts, storage.WithLRUEviction())
+	}
+
+	store := storage.NewStore(opts...)
+	if *aof != "" {
+		policy, err := storage.ParseSyncPolicy(*aofSync)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if err := store.EnableAOF(*aof, policy); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// With a script as argument, the repl runs in batch mode.
+	var replOpts []repl.Option
+	if *strict {
+		replOpts = append(replOpts, repl.WithStrict())
+	}
+
+	if *ack {
+		replOpts = append(replOpts, repl.WithAck())
+	}
+
+	if *echo {
+		replOpts = append(replOpts, repl.WithEcho())
+	}
+
+	if *check {
+		replOpts = append(replOpts, repl.WithCheck())
+	}
+
+	if *safe {
+		replOpts = append(replOpts, repl.WithSafe())
+	}
+
+	if *color {
+		replOpts = append(replOpts, repl.WithColor())
+	}
+
+	if *baseDir != "" {
+		replOpts = append(replOpts, repl.WithBaseDir(*baseDir))
+	}
+
+	if *initFile != "" {
+		f, err := os.Open(*initFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		replOpts = append(replOpts, repl.WithInit(f))
+	}
+
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		replOpts = append(replOpts, repl.WithInput(f), repl.WithBatch())
+	}
+
+	code := repl.NewRepl(store, replOpts...).Run()
+	if err := store.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+
+	os.Exit(code)
 }
@@ -0,0 +1,50 @@
+package repl
+
+import (
+	"strings"
+)
+
+// WithCheck makes the repl only parse the input, without executing it, to
+// lint scripts. Every invalid line is reported, with its line number like in
+// batch mode, and Run returns 1 if there is any. The Store is not touched.
+func WithCheck() Option {
+	return func(r *repl) {
+		r.check = true
+	}
+}
+
+// checkInput parses every line of the input and prints the errors. Blank
+// lines, a shebang in the first line and the value lines of writestdin are
+// skipped, as when running the script. It returns the number of invalid
+// lines.
+func (r *repl) checkInput() int {
+	r.batch = true
+
+	invalid := 0
+	for {
+		in, err := r.read()
+		if err != nil {
+			return invalid
+		}
+
+		if len(in) == 0 || r.line == 1 && strings.HasPrefix(in, shebang) {
+			continue
+		}
+
+		cmd, _, err := r.parse(in)
+		if err != nil {
+			r.printErr(in, err)
+			invalid++
+			continue
+		}
+
+		if cmd == writeStdin {
+			_, n, err := r.readValue()
+			if err != nil {
+				r.printErr(in, err)
+				invalid++
+			}
+			r.line += n
+		}
+	}
+}
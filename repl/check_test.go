@@ -0,0 +1,66 @@
+package repl
+
+import (
+	"bytes"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	script := "#!/usr/bin/env kvrepl\n" +
+		"write a 1\n" +
+		"\n" +
+		"writ a 1\n" +
+		"read\n" +
+		"writestdin b\n" +
+		"not a command\n" +
+		".\n" +
+		"remove a b\n" +
+		"exit\n" +
+		"writestdin c\n" +
+		"never terminated\n"
+
+	var out, errOut bytes.Buffer
+	store := storage.NewStore()
+	code := NewRepl(store,
+		WithInput(strings.NewReader(script)),
+		WithOutput(&out),
+		WithErrOutput(&errOut),
+		WithCheck(),
+	).Run()
+
+	if code != 1 {
+		t.Errorf("\nGot exit code %d want 1", code)
+	}
+
+	if out.String() != "" {
+		t.Errorf("\nGot output '%s' want none", out.String())
+	}
+
+	wantErrOut := "line 4: Unsupported command: writ (did you mean 'write'?) (writ a 1)\n" +
+		"line 5: Invalid Number of arguments: READ (required: 1) (read)\n" +
+		"line 9: Invalid Number of arguments: REMOVE (required: 1) (remove a b)\n" +
+		"line 11: Value not terminated (writestdin c)\n"
+	if errOut.String() != wantErrOut {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut.String(), wantErrOut)
+	}
+
+	// nothing was executed
+	if _, err := store.Process("read", "a"); err == nil {
+		t.Errorf("\nGot key 'a' written want the Store untouched")
+	}
+}
+
+func TestCheckValid(t *testing.T) {
+	code := NewRepl(storage.NewStore(),
+		WithInput(strings.NewReader("write a 1\nread a\n")),
+		WithOutput(&bytes.Buffer{}),
+		WithErrOutput(&bytes.Buffer{}),
+		WithCheck(),
+	).Run()
+
+	if code != 0 {
+		t.Errorf("\nGot exit code %d want 0", code)
+	}
+}
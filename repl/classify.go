@@ -0,0 +1,63 @@
+package repl
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"sort"
+	"strings"
+)
+
+// classes of the commands printed by the classify command.
+const (
+	classMutating = "mutating"
+	classReadOnly = "read-only"
+)
+
+// mutatingReplCommands classifies the repl commands, like the Store classifies
+// its own: true if they change the session, its data or settings.
+var mutatingReplCommands = map[string]bool{
+	exit:       false,
+	set:        true,
+	writeStdin: true,
+	version:    false,
+	sleep:      false,
+	classify:   false,
+	completion: false,
+	source:     true,
+	parseInput: false,
+}
+
+// commandClass returns the class of the command cmd, and false if it has
+// none.
+func commandClass(cmd string) (string, bool) {
+	mutating, ok := mutatingReplCommands[cmd]
+	if !ok {
+		mutating, ok = storage.IsMutating(cmd)
+	}
+
+	switch {
+	case !ok:
+		return "", false
+	case mutating:
+		return classMutating, true
+	default:
+		return classReadOnly, true
+	}
+}
+
+// classification returns the class of every valid command, one
+// "command: class" per line, sorted by command.
+func classification() string {
+	cmds := make([]string, 0, len(validCommands))
+	for cmd := range validCommands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+
+	lines := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		class, _ := commandClass(cmd)
+		lines = append(lines, cmd+": "+class)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,61 @@
+package repl
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCommandClassComplete(t *testing.T) {
+	for cmd := range validCommands {
+		if _, ok := commandClass(cmd); !ok {
+			t.Errorf("\nGot no class for command '%s'", cmd)
+		}
+	}
+}
+
+func TestReadOnlyCommands(t *testing.T) {
+	want := []string{
+		"assert", "check", "classify", "commitcost", "committiming",
+		"completion", "countvalues", "difffiles", "dirty", "eq", "exit", "explain",
+		"exportjson", "exportlog", "exportprefix", "grep", "info", "inspect", "keyhistory",
+		"lastseq", "lenhist", "list", "metrics", "mgetprefix", "note", "parse", "read",
+		"readall", "readat", "readb64", "readhex", "savepoints", "sleep", "snapshot", "sortbyvalue", "stats", "storehash",
+		"top", "tree", "txkeys", "txsizes", "verify", "version",
+	}
+
+	var got []string
+	for cmd := range validCommands {
+		if class, _ := commandClass(cmd); class == classReadOnly {
+			got = append(got, cmd)
+		}
+	}
+	sort.Strings(got)
+
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("\nGot read-only commands '%s' want '%s'", got, want)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	out, errOut := run("classify\n", WithBatch())
+
+	if errOut != "" {
+		t.Fatalf("\nGot errors '%s' want none", errOut)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != len(validCommands) {
+		t.Errorf("\nGot %d lines want %d", len(lines), len(validCommands))
+	}
+
+	if !sort.StringsAreSorted(lines) {
+		t.Errorf("\nGot unsorted lines '%s'", out)
+	}
+
+	for _, want := range []string{"read: read-only", "write: mutating", "set: mutating"} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("\nGot output '%s' want line '%s'", out, want)
+		}
+	}
+}
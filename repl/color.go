@@ -0,0 +1,54 @@
+package repl
+
+import (
+	"io"
+	"os"
+)
+
+// ANSI escape codes of the colored output.
+const (
+	colorRed   = "\x1b[31m"
+	colorReset = "\x1b[0m"
+)
+
+// terminal reports whether a writer is a terminal. Tests replace it to
+// simulate one.
+type terminal interface {
+	isTerminal(w io.Writer) bool
+}
+
+// fileTerminal is the terminal detection of the files: a file is a terminal
+// if it is a character device, like os.Stdout in an interactive session.
+type fileTerminal struct{}
+
+func (fileTerminal) isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// WithColor makes the repl print the errors in red, if the error output is a
+// terminal. Output redirected to a file or a pipe is never colored. The values
+// are printed in the default color of the terminal.
+func WithColor() Option {
+	return func(r *repl) {
+		r.color = true
+	}
+}
+
+// colorize returns msg in the color c, if the repl colors its output.
+func (r *repl) colorize(msg, c string) string {
+	if !r.color {
+		return msg
+	}
+
+	return c + msg + colorReset
+}
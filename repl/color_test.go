@@ -0,0 +1,87 @@
+package repl
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// fakeTerminal reports every writer as a terminal if true.
+type fakeTerminal bool
+
+func (f fakeTerminal) isTerminal(w io.Writer) bool {
+	return bool(f)
+}
+
+func withTerminal(term terminal) Option {
+	return func(r *repl) {
+		r.term = term
+	}
+}
+
+func TestColor(t *testing.T) {
+	script := "write a 1\nread a\nread b\n"
+	interactiveOut := "> > 1\n> > "
+
+	cases := []struct {
+		name       string
+		opts       []Option
+		wantOut    string
+		wantErrOut string
+	}{
+		{
+			name:       "terminal",
+			opts:       []Option{WithColor(), withTerminal(fakeTerminal(true))},
+			wantOut:    interactiveOut,
+			wantErrOut: colorRed + "Key not found: b" + colorReset + "\n",
+		},
+		{
+			name:       "not a terminal",
+			opts:       []Option{WithColor(), withTerminal(fakeTerminal(false))},
+			wantOut:    interactiveOut,
+			wantErrOut: "Key not found: b\n",
+		},
+		{
+			name:       "disabled",
+			opts:       []Option{withTerminal(fakeTerminal(true))},
+			wantOut:    interactiveOut,
+			wantErrOut: "Key not found: b\n",
+		},
+		{
+			name:       "batch",
+			opts:       []Option{WithColor(), withTerminal(fakeTerminal(true)), WithBatch()},
+			wantOut:    "1\n",
+			wantErrOut: colorRed + "line 3: Key not found: b (read b)" + colorReset + "\n",
+		},
+	}
+
+	for _, tc := range cases {
+		out, errOut := run(script, tc.opts...)
+
+		// values are printed in the default color
+		if out != tc.wantOut {
+			t.Errorf("\n%s: Got output '%q' want '%q'", tc.name, out, tc.wantOut)
+		}
+
+		if errOut != tc.wantErrOut {
+			t.Errorf("\n%s: Got errors '%q' want '%q'", tc.name, errOut, tc.wantErrOut)
+		}
+	}
+}
+
+func TestFileTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer f.Close()
+
+	var term fileTerminal
+	if term.isTerminal(f) {
+		t.Errorf("\nGot regular file as terminal")
+	}
+
+	if term.isTerminal(io.Discard) {
+		t.Errorf("\nGot non file writer as terminal")
+	}
+}
@@ -0,0 +1,42 @@
+package repl
+
+import (
+	"fmt"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"sort"
+	"strings"
+)
+
+// completionName is the name of the binary the completion scripts complete.
+const completionName = "kvrepl"
+
+// completionScripts are the templates of the completion scripts, by shell.
+// The first %s is the name of the binary, the second the space separated
+// commands.
+var completionScripts = map[string]string{
+	"bash": `_%[1]s() {
+	COMPREPLY=($(compgen -W "%[2]s" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -F _%[1]s %[1]s`,
+	"zsh": `#compdef %[1]s
+_arguments '*:command:(%[2]s)'`,
+}
+
+// completionScript returns the completion script of the valid commands for
+// shell.
+//
+// completionScript returns storage.ErrInvalidArgument if the shell is not supported.
+func completionScript(shell string) (string, error) {
+	tmpl, ok := completionScripts[shell]
+	if !ok {
+		return "", fmt.Errorf("%w: %s (bash or zsh required)", storage.ErrInvalidArgument, shell)
+	}
+
+	cmds := make([]string, 0, len(validCommands))
+	for cmd := range validCommands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+
+	return fmt.Sprintf(tmpl, completionName, strings.Join(cmds, " ")), nil
+}
@@ -0,0 +1,52 @@
+package repl
+
+import (
+	"errors"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"strings"
+	"testing"
+)
+
+func TestCompletionBash(t *testing.T) {
+	out, errOut := run("completion bash\n", WithBatch())
+
+	if errOut != "" {
+		t.Fatalf("\nGot errors '%s' want none", errOut)
+	}
+
+	if !strings.Contains(out, "complete -F _kvrepl kvrepl") {
+		t.Errorf("\nGot script '%s' want a bash complete registration", out)
+	}
+
+	words := strings.Fields(out)
+	for cmd := range validCommands {
+		found := false
+		for _, w := range words {
+			if strings.Trim(w, `"`) == cmd {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Errorf("\nGot no command '%s' in script '%s'", cmd, out)
+		}
+	}
+}
+
+func TestCompletionZsh(t *testing.T) {
+	script, err := completionScript("zsh")
+	if err != nil {
+		t.Fatalf("\nGot error '%v' want none", err)
+	}
+
+	if !strings.HasPrefix(script, "#compdef kvrepl") {
+		t.Errorf("\nGot script '%s' want a zsh compdef header", script)
+	}
+}
+
+func TestCompletionUnsupportedShell(t *testing.T) {
+	if _, err := completionScript("fish"); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Errorf("\nGot error '%v' want '%v'", err, storage.ErrInvalidArgument)
+	}
+}
@@ -0,0 +1,32 @@
+package repl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// explainParse returns how the input line tokenizes and parses, without
+// executing it: its tokens, then either the command and its arguments or
+// the parse error. The tokens are quoted to show their exact content. Quotes
+// in line are not special: they are part of the tokens.
+func (r *repl) explainParse(line string) string {
+	fields := strings.Fields(line)
+	tokens := make([]string, len(fields))
+	for i, f := range fields {
+		tokens[i] = fmt.Sprintf("%q", f)
+	}
+
+	lines := []string{"tokens: " + strings.Join(tokens, " ")}
+
+	cmd, args, err := r.parse(line)
+	if err != nil {
+		return strings.Join(append(lines, "error: "+err.Error()), "\n")
+	}
+
+	lines = append(lines, fmt.Sprintf("command: %q", cmd))
+	for i, a := range args {
+		lines = append(lines, fmt.Sprintf("arg %d: %q", i+1, a))
+	}
+
+	return strings.Join(lines, "\n")
+}
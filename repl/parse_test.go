@@ -0,0 +1,50 @@
+package repl
+
+import (
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{
+			input: "parse write a 1",
+			want:  "tokens: \"write\" \"a\" \"1\"\ncommand: \"write\"\narg 1: \"a\"\narg 2: \"1\"\n",
+		},
+		{
+			input: "parse   WRITE    a\t\t1  ",
+			want:  "tokens: \"WRITE\" \"a\" \"1\"\ncommand: \"write\"\narg 1: \"a\"\narg 2: \"1\"\n",
+		},
+		{
+			input: "parse write \"a b\" 1",
+			want: "tokens: \"write\" \"\\\"a\" \"b\\\"\" \"1\"\n" +
+				"error: Invalid Number of arguments: WRITE (required: 2)\n",
+		},
+		{
+			input: "parse write 'a' 1",
+			want:  "tokens: \"write\" \"'a'\" \"1\"\ncommand: \"write\"\narg 1: \"'a'\"\narg 2: \"1\"\n",
+		},
+		{
+			input: "parse writ a 1",
+			want:  "tokens: \"writ\" \"a\" \"1\"\nerror: Unsupported command: writ (did you mean 'write'?)\n",
+		},
+		{
+			input: "parse parse read a",
+			want:  "tokens: \"parse\" \"read\" \"a\"\ncommand: \"parse\"\narg 1: \"read\"\narg 2: \"a\"\n",
+		},
+	}
+
+	for _, tc := range cases {
+		out, errOut := run(tc.input+"\nread a\n", WithBatch())
+
+		if errOut != "line 2: Key not found: a (read a)\n" {
+			t.Errorf("\nGot errors '%s' for input '%s': the line must not execute", errOut, tc.input)
+		}
+
+		if out != tc.want {
+			t.Errorf("\nGot output '%s' want '%s' for input '%s'", out, tc.want, tc.input)
+		}
+	}
+}
@@ -4,137 +4,713 @@ package repl
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/caasmo/kv-repl-barebones/storage"
+	"io"
+	"math"
 	"os"
 	"strings"
+	"time"
 )
 
-// exit is the command to exit the repl
-const exit = "exit"
+// repl commands, handled by the repl instead of the Store.
+const (
+	// exit is the command to exit the repl
+	exit = "exit"
+
+	// set is the command to set a repl option at runtime
+	set = "set"
+
+	// writeStdin is the command to write a value read from the following
+	// input lines, up to a line with only the valueTerminator.
+	writeStdin = "writestdin"
+
+	// version is the command to print the version of the binary
+	version = "version"
+
+	// sleep is the command to wait a number of milliseconds
+	sleep = "sleep"
+
+	// classify is the command to print whether each command is mutating or
+	// read-only
+	classify = "classify"
+
+	// completion is the command to print a shell completion script of the
+	// commands
+	completion = "completion"
+
+	// source is the command to run the commands of a script file
+	source = "source"
+
+	// parseInput is the command to print how the rest of its line parses,
+	// without executing it
+	parseInput = "parse"
+)
+
+// valueTerminator ends the value of the writestdin command.
+const valueTerminator = "."
+
+// shebang starts the first line of an executable script, like
+// #!/usr/bin/env kvrepl.
+const shebang = "#!"
+
+// echoPrefix precedes the echoed input lines.
+const echoPrefix = ">> "
+
+// value formats of the read command.
+const (
+	// formatRaw prints the values as stored.
+	formatRaw = "raw"
+
+	// formatJSONPretty indents the values that are valid JSON.
+	formatJSONPretty = "json-pretty"
+)
 
 // validCommands are the commands supported by the repl
 //
 // The values of the map are the required number of arguments for each command.
 var validCommands = map[string]int{
-	storage.Write:   2,
-	storage.Read:    1,
-	storage.Remove:  1,
-	storage.Begin:   0,
-	storage.Commit:  0,
-	storage.Discard: 0,
-	exit:            0,
+	storage.Write:    2,
+	storage.Read:     1,
+	storage.Remove:   1,
+	storage.Begin:    0,
+	storage.Commit:   0,
+	storage.Discard:  0,
+	storage.TxKeys:   0,
+	storage.SetEx:    3,
+	storage.GetDel:   1,
+	storage.Annotate: 2,
+	storage.Note:     1,
+
+	storage.SnapshotFile: 1,
+	storage.RestoreFile:  1,
+	storage.RewriteAOF:   0,
+	storage.AOF:          1,
+
+	storage.CommitCost: 0,
+	storage.Check:      0,
+	storage.Metrics:    0,
+	storage.KeyHistory: 1,
+	storage.ResetTx:    0,
+
+	storage.Checkpoint:        1,
+	storage.RestoreCheckpoint: 1,
+
+	storage.Tree:      0,
+	storage.MergeFile: 1,
+	storage.List:      0,
+	storage.Dirty:     0,
+	storage.Compact:   0,
+	storage.ReadAll:   0,
+	storage.Eq:        2,
+	storage.Assert:    2,
+	storage.Grep:      1,
+
+	storage.RenamePrefix: 2,
+	storage.CopyPrefix:   2,
+	storage.Flatten:      0,
+	storage.MGetPrefix:   1,
+	storage.CommitTiming: 0,
+	storage.Verify:       2,
+	storage.StoreHash:    0,
+
+	storage.Savepoint:  1,
+	storage.RollbackTo: 1,
+	storage.Savepoints: 0,
+
+	storage.TxSizes:    0,
+	storage.AutoCommit: 1,
+	storage.Stats:      0,
+
+	storage.Truncate: 2,
+	storage.Replace:  3,
+	storage.Reverse:  1,
+	storage.Upper:    1,
+	storage.Lower:    1,
+	storage.Inspect:  1,
+
+	storage.WriteEnv:     2,
+	storage.ExportPrefix: 2,
+	storage.CountValues:  0,
+	storage.LenHist:      0,
+	storage.Top:          1,
+	storage.ImportJSON:   1,
+	storage.ExportJSON:   1,
+	storage.DiffFiles:    2,
+	storage.Patch:        1,
+	storage.Flush:        0,
+	storage.Explain:      1,
+	storage.ReadAt:       2,
+	storage.LastSeq:      0,
+	storage.SortByValue:  0,
+	storage.ExportLog:    1,
+	storage.ImportLog:    1,
+
+	storage.DeleteMatching: 1,
+	storage.WriteHex:       2,
+	storage.ReadHex:        1,
+	storage.WriteB64:       2,
+	storage.ReadB64:        1,
+	storage.Info:           0,
+
+	exit:       0,
+	set:        2,
+	writeStdin: 1,
+	version:    0,
+	sleep:      1,
+	classify:   0,
+	completion: 1,
+	source:     1,
+	parseInput: 1,
+}
+
+// optionalArgs are the number of optional arguments of the commands that
+// accept them, after the required ones.
+var optionalArgs = map[string]int{
+	storage.Metrics: 1,
+	storage.List:    2,
+	storage.Stats:   1,
 }
 
 var (
 	errUnsupportedCommand  error = errors.New("Unsupported command")
 	errNoCommand           error = errors.New("No command given")
 	errInvalidNumArguments error = errors.New("Invalid Number of arguments")
+
+	// errExit signals the end of the loop by the exit command.
+	errExit error = errors.New("exit")
+
+	errUnterminatedValue error = errors.New("Value not terminated")
+
+	// errAborted signals a destructive command not confirmed in safe mode.
+	errAborted error = errors.New("Command aborted")
 )
 
 // repl represents a simple repl (Read, Evaluate, Print and Loop).
 type repl struct {
-	store *storage.Store
+	store  *storage.Store
+	in     *bufio.Reader
+	out    io.Writer
+	errOut io.Writer
+
+	// batch is true if the input is a script instead of an interactive
+	// session. In batch mode there is no prompt, blank lines are skipped and
+	// errors are annotated with the line number and the offending input.
+	batch bool
+
+	// strict aborts the loop at the first error.
+	strict bool
+
+	// line is the number of the last line read.
+	line int
+
+	// echo prints each input line before executing it.
+	echo bool
+
+	// check only parses the input, reporting the invalid lines.
+	check bool
+
+	// safe asks for confirmation before the destructive commands in
+	// interactive mode.
+	safe bool
+
+	// color prints the errors in red. Only enabled if the error output is a
+	// terminal, as reported by term.
+	color bool
+	term  terminal
+
+	// options settable at runtime with the set command.
+
+	// timing prints the time taken by each command.
+	timing bool
+
+	// json prints results and errors as JSON objects.
+	json bool
+
+	// ack prints an acknowledgement for the commands without output.
+	ack bool
+
+	// promptText is the prompt of the interactive mode.
+	promptText string
+
+	// format is the format of the values printed by read.
+	format string
+
+	// sleepFunc waits for the sleep command.
+	sleepFunc func(time.Duration)
+
+	// init is the setup script run in batch mode before the input. nil if
+	// there is none.
+	init io.Reader
+
+	// baseDir is the directory of the relative paths of the source command.
+	// Empty for the working directory.
+	baseDir string
+
+	// sourceDepth is the number of nested source commands running.
+	sourceDepth int
+
+	// sourceFile is the path of the script file being sourced. Empty for the
+	// input of the repl.
+	sourceFile string
+}
+
+// Option configures a repl on creation.
+type Option func(*repl)
+
+// WithInput makes the repl read the commands from in instead of os.Stdin.
+func WithInput(in io.Reader) Option {
+	return func(r *repl) {
+		r.in = bufio.NewReader(in)
+	}
+}
+
+// WithOutput makes the repl print the results to out instead of os.Stdout.
+func WithOutput(out io.Writer) Option {
+	return func(r *repl) {
+		r.out = out
+	}
 }
 
-// NewRepl returns a repl.
-func NewRepl(s *storage.Store) *repl {
-	return &repl{store: s}
+// WithErrOutput makes the repl print the errors to errOut instead of
+// os.Stderr.
+func WithErrOutput(errOut io.Writer) Option {
+	return func(r *repl) {
+		r.errOut = errOut
+	}
+}
+
+// WithBatch runs the repl in batch mode.
+func WithBatch() Option {
+	return func(r *repl) {
+		r.batch = true
+	}
+}
+
+// WithStrict makes the repl stop at the first failing command. By default
+// errors are printed and the loop continues.
+func WithStrict() Option {
+	return func(r *repl) {
+		r.strict = true
+	}
+}
+
+// WithAck makes the repl acknowledge the successful commands without output
+// (write, begin, commit...) with OK, so scripts can confirm each step.
+func WithAck() Option {
+	return func(r *repl) {
+		r.ack = true
+	}
+}
+
+// WithEcho makes the repl print each input line, prefixed with ">> ", to the
+// output before executing it, so the results of a piped session can be
+// correlated with the commands.
+func WithEcho() Option {
+	return func(r *repl) {
+		r.echo = true
+	}
 }
 
-// prompt prints the prompt to Stdout.
+// WithSleep makes the sleep command call sleep instead of time.Sleep. Tests
+// use it to advance a fake clock of the Store instead of blocking.
+func WithSleep(sleep func(time.Duration)) Option {
+	return func(r *repl) {
+		r.sleepFunc = sleep
+	}
+}
+
+// WithInit makes the repl run the commands of init, in batch mode, before
+// reading the input. The input sees the data of init, as both run on the
+// same Store.
+func WithInit(init io.Reader) Option {
+	return func(r *repl) {
+		r.init = init
+	}
+}
+
+// NewRepl returns a repl configured with the options opts.
+func NewRepl(s *storage.Store, opts ...Option) *repl {
+	r := &repl{
+		store:  s,
+		in:     bufio.NewReader(os.Stdin),
+		out:    os.Stdout,
+		errOut: os.Stderr,
+
+		promptText: ">",
+		format:     formatRaw,
+		sleepFunc:  time.Sleep,
+		term:       fileTerminal{},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.color = r.color && r.term.isTerminal(r.errOut)
+
+	return r
+}
+
+// prompt prints the prompt to the output. There is no prompt in batch mode.
 func (r *repl) prompt() {
-	fmt.Print("> ")
+	if r.batch {
+		return
+	}
+
+	fmt.Fprint(r.out, r.promptText+" ")
 }
 
-// read reads the user input from the os.Stdin
-func (r *repl) read() string {
-	reader := bufio.NewReader(os.Stdin)
-	t, _ := reader.ReadString('\n')
-	return strings.TrimSpace(t)
+// read reads the next line of the input. Lines can be arbitrarily long:
+// ReadString grows its result past the size of the reader buffer, unlike
+// ReadLine or a bufio.Scanner.
+//
+// read returns io.EOF when the input is exhausted.
+func (r *repl) read() (string, error) {
+	t, err := r.in.ReadString('\n')
+	if err != nil && len(t) == 0 {
+		return "", err
+	}
+
+	r.line++
+	return strings.TrimSpace(t), nil
 }
 
-// print prints a string to Stdout.
+// readValue reads the lines of the input up to a line with only the
+// valueTerminator, and returns them joined and the number of lines read. The
+// lines are kept verbatim.
+//
+// readValue returns errUnterminatedValue if the input is exhausted before the
+// terminator.
+func (r *repl) readValue() (string, int, error) {
+	var lines []string
+	for {
+		t, err := r.in.ReadString('\n')
+		if err != nil && len(t) == 0 {
+			return "", len(lines), errUnterminatedValue
+		}
+
+		t = strings.TrimRight(t, "\r\n")
+		if t == valueTerminator {
+			return strings.Join(lines, "\n"), len(lines) + 1, nil
+		}
+
+		lines = append(lines, t)
+	}
+}
+
+// print prints a string to the output. In JSON mode the string is the result
+// field of an object.
 func (r *repl) print(msg string) {
-	fmt.Println(msg)
+	if r.json {
+		r.printJSON(r.out, map[string]interface{}{"result": msg})
+		return
+	}
+
+	fmt.Fprintln(r.out, msg)
 }
 
-// parse parses and validates the input from the user.
-// It returns the command, key, value and error.
-func (r *repl) parse(in string) (string, string, string, error) {
+// formatValue returns the value v in the format of the repl. The stored value
+// is not changed.
+func (r *repl) formatValue(v string) string {
+	if r.format != formatJSONPretty || !json.Valid([]byte(v)) {
+		return v
+	}
 
-	// Commands are case-insensitive.
-	in = strings.ToLower(in)
+	var b bytes.Buffer
+	if err := json.Indent(&b, []byte(v), "", "  "); err != nil {
+		return v
+	}
+
+	return b.String()
+}
+
+// printErr prints the error err caused by the input in to the error output.
+// In batch mode the error is prefixed with the line number, and the path of
+// the sourced file if any, and followed by the input. In JSON mode they are
+// the fields of an object.
+func (r *repl) printErr(in string, err error) {
+	switch {
+	case r.json && r.batch:
+		obj := map[string]interface{}{"error": err.Error(), "line": r.line, "input": in}
+		if r.sourceFile != "" {
+			obj["file"] = r.sourceFile
+		}
+		r.printJSON(r.errOut, obj)
+	case r.json:
+		r.printJSON(r.errOut, map[string]interface{}{"error": err.Error()})
+	case r.batch && r.sourceFile != "":
+		fmt.Fprintln(r.errOut, r.colorize(fmt.Sprintf("%s line %d: %s (%s)", r.sourceFile, r.line, err, in), colorRed))
+	case r.batch:
+		fmt.Fprintln(r.errOut, r.colorize(fmt.Sprintf("line %d: %s (%s)", r.line, err, in), colorRed))
+	default:
+		fmt.Fprintln(r.errOut, r.colorize(err.Error(), colorRed))
+	}
+}
+
+// printAck prints the acknowledgement of a successful command without output.
+func (r *repl) printAck() {
+	if r.json {
+		r.printJSON(r.out, map[string]interface{}{"ok": true})
+		return
+	}
+
+	fmt.Fprintln(r.out, "OK")
+}
+
+// printTime prints the duration d taken by a command.
+func (r *repl) printTime(d time.Duration) {
+	if r.json {
+		r.printJSON(r.out, map[string]interface{}{"time": d.String()})
+		return
+	}
+
+	fmt.Fprintf(r.out, "time: %s\n", d)
+}
+
+// printJSON prints the object obj to w as a JSON line.
+func (r *repl) printJSON(w io.Writer, obj map[string]interface{}) {
+	b, _ := json.Marshal(obj)
+	fmt.Fprintln(w, string(b))
+}
+
+// fail prints the error err caused by the input in. fail returns err in
+// strict mode, and nil otherwise, so the loop continues.
+func (r *repl) fail(in string, err error) error {
+	r.printErr(in, err)
+	if r.strict {
+		return err
+	}
+
+	return nil
+}
+
+// parse parses and validates the input from the user.
+// It returns the command, its arguments and error.
+func (r *repl) parse(in string) (string, []string, error) {
 
 	fields := strings.Fields(in)
 
 	if len(fields) == 0 {
-		return "", "", "", errNoCommand
+		return "", nil, errNoCommand
 	}
 
+	// Commands are case-insensitive. Arguments, like file paths, keep their
+	// case.
+	fields[0] = strings.ToLower(fields[0])
+
 	numParams, ok := validCommands[fields[0]]
 
 	if !ok {
-		return "", "", "", fmt.Errorf("%w: %s", errUnsupportedCommand, fields[0])
+		if s := suggest(fields[0]); s != "" {
+			return "", nil, fmt.Errorf("%w: %s (did you mean '%s'?)", errUnsupportedCommand, fields[0], s)
+		}
+
+		return "", nil, fmt.Errorf("%w: %s", errUnsupportedCommand, fields[0])
+	}
+
+	// the arguments of parse are a whole input line, of any length.
+	if fields[0] == parseInput && len(fields) > 1 {
+		return fields[0], fields[1:], nil
+	}
+
+	optional := optionalArgs[fields[0]]
+	if n := len(fields) - 1; n < numParams || n > numParams+optional {
+		if optional > 0 {
+			return "", nil, fmt.Errorf("%w: %s (required: %d, optional: %d)", errInvalidNumArguments, strings.ToUpper(fields[0]), numParams, optional)
+		}
+
+		return "", nil, fmt.Errorf("%w: %s (required: %d)", errInvalidNumArguments, strings.ToUpper(fields[0]), numParams)
+	}
+
+	return fields[0], fields[1:], nil
+}
+
+// Run starts the repl. Run returns when the input is exhausted, on the exit
+// command or, in strict mode, at the first failing command. The init script,
+// if any, runs first: the exit command or a strict error there also ends Run.
+//
+// Run returns the exit code: 0 on success and 1 if aborted by an error. In
+// check mode, Run only parses the input and returns 1 if any line is invalid.
+func (r *repl) Run() int {
+	if r.check {
+		if r.checkInput() > 0 {
+			return 1
+		}
+
+		return 0
 	}
 
-	if numParams != len(fields)-1 {
-		return "", "", "", fmt.Errorf("%w: %s (required: %d)", errInvalidNumArguments, strings.ToUpper(fields[0]), numParams)
+	if r.init != nil {
+		if err := r.runInit(); !errors.Is(err, io.EOF) {
+			return exitCode(err)
+		}
 	}
 
-	command := fields[0]
-	key := ""
-	value := ""
+	return exitCode(r.loop())
+}
 
-	switch len(fields) {
-	case 1:
-		break
-	case 2:
-		key = fields[1]
-		break
-	case 3:
-		key = fields[1]
-		value = fields[2]
+// exitCode returns the exit code of Run for the error err ending the loop.
+func exitCode(err error) int {
+	if errors.Is(err, io.EOF) || errors.Is(err, errExit) {
+		return 0
 	}
 
-	return command, key, value, nil
+	return 1
 }
 
-// Run starts the repl.
-func (r repl) Run() {
+// loop iterates the repl until next returns an error, and returns it.
+func (r *repl) loop() error {
 	for {
-		r.next()
+		if err := r.next(); err != nil {
+			return err
+		}
 	}
 }
 
+// runInit runs the init script in batch mode, and then restores the input,
+// the mode and the line count.
+func (r *repl) runInit() error {
+	in, batch := r.in, r.batch
+	defer func() {
+		r.in, r.batch, r.line = in, batch, 0
+	}()
+
+	r.in, r.batch = bufio.NewReader(r.init), true
+	return r.loop()
+}
+
 // next iterates the repl.
-func (r repl) next() {
+//
+// next returns io.EOF if there is no more input and errExit on the exit
+// command. In strict mode, next returns the error of a failing command.
+func (r *repl) next() error {
 	r.prompt()
-	in := r.read()
-	cmd, key, value, err := r.parse(in)
+	in, err := r.read()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
+		return err
+	}
+
+	if r.batch && len(in) == 0 {
+		return nil
+	}
+
+	// a shebang is only skipped in the first line of a script.
+	if r.batch && r.line == 1 && strings.HasPrefix(in, shebang) {
+		return nil
 	}
 
-	// exit is a repl command, not a storage one. Handled here.
+	if r.echo {
+		fmt.Fprintln(r.out, echoPrefix+in)
+	}
+
+	cmd, args, err := r.parse(in)
+	if err != nil {
+		return r.fail(in, err)
+	}
+
+	// exit, set, version, sleep, classify, completion, source, parse and
+	// writestdin are repl commands, not storage ones. Handled here.
 	if cmd == exit {
-		os.Exit(0)
+		return errExit
 	}
 
-	v, err := r.store.Process(cmd, key, value)
+	if cmd == version {
+		r.print(Version())
+		return nil
+	}
+
+	if cmd == classify {
+		r.print(classification())
+		return nil
+	}
+
+	if cmd == completion {
+		script, err := completionScript(args[0])
+		if err != nil {
+			return r.fail(in, err)
+		}
+
+		r.print(script)
+		return nil
+	}
 
-	// All errors are output to stderr.
+	// parse gets the rest of the input verbatim, with its whitespace.
+	if cmd == parseInput {
+		r.print(r.explainParse(in[len(cmd):]))
+		return nil
+	}
+
+	if cmd == source {
+		return r.source(in, args[0])
+	}
+
+	if cmd == sleep {
+		ms, err := storage.IntArg("milliseconds", args[0], 0)
+		if err != nil {
+			return r.fail(in, err)
+		}
+
+		// the duration would overflow.
+		if maxMs := math.MaxInt64 / int64(time.Millisecond); int64(ms) > maxMs {
+			return r.fail(in, fmt.Errorf("%w: milliseconds %s (maximum %d)", storage.ErrInvalidArgument, args[0], maxMs))
+		}
+
+		r.sleepFunc(time.Duration(ms) * time.Millisecond)
+		return nil
+	}
+
+	if cmd == set {
+		if err := r.set(args[0], args[1]); err != nil {
+			return r.fail(in, err)
+		}
+
+		return nil
+	}
+
+	// writestdin is a write whose value follows in the input. Errors refer to
+	// the line of the command, the value lines are counted afterwards.
+	if cmd == writeStdin {
+		value, n, err := r.readValue()
+		defer func() { r.line += n }()
+		if err != nil {
+			return r.fail(in, err)
+		}
+
+		cmd, args = storage.Write, []string{args[0], value}
+	}
+
+	if r.safe && !r.batch && destructiveCommands[cmd] && !r.confirm() {
+		return r.fail(in, errAborted)
+	}
+
+	start := time.Now()
+	v, err := r.store.Process(cmd, args...)
+
+	// the time is printed after the result or error.
+	if r.timing {
+		elapsed := time.Since(start)
+		defer r.printTime(elapsed)
+	}
+
+	// All errors are output to the error output.
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
+		return r.fail(in, err)
+	}
+
+	if cmd == storage.Read {
+		v = r.formatValue(v)
 	}
 
 	// For simpicity empty values are not allowed.
 	if len(v) > 0 {
-		fmt.Fprintln(os.Stdout, v)
+		r.print(v)
+	} else if r.ack {
+		r.printAck()
 	}
 
-	return
+	return nil
 }
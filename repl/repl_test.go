@@ -1,9 +1,13 @@
 package repl
 
 import (
+	"bytes"
 	"errors"
 	"github.com/caasmo/kv-repl-barebones/storage"
+	"io"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseErrors(t *testing.T) {
@@ -31,12 +35,157 @@ func TestParseErrors(t *testing.T) {
 		{input: "begin 4", wantErr: errInvalidNumArguments},
 		{input: "commit", wantErr: nil},
 		{input: "commit 4", wantErr: errInvalidNumArguments},
+		{input: "txkeys", wantErr: nil},
+		{input: "txkeys a", wantErr: errInvalidNumArguments},
+		{input: "setex a 10 hi", wantErr: nil},
+		{input: "setex a 10", wantErr: errInvalidNumArguments},
+		{input: "getdel a", wantErr: nil},
+		{input: "getdel", wantErr: errInvalidNumArguments},
+		{input: "annotate a b", wantErr: nil},
+		{input: "annotate a", wantErr: errInvalidNumArguments},
+		{input: "note a", wantErr: nil},
+		{input: "note a b", wantErr: errInvalidNumArguments},
+		{input: "snapshot f", wantErr: nil},
+		{input: "snapshot", wantErr: errInvalidNumArguments},
+		{input: "restore f", wantErr: nil},
+		{input: "restore", wantErr: errInvalidNumArguments},
+		{input: "bgrewriteaof", wantErr: nil},
+		{input: "bgrewriteaof f", wantErr: errInvalidNumArguments},
+		{input: "aof off", wantErr: nil},
+		{input: "aof", wantErr: errInvalidNumArguments},
+		{input: "commitcost", wantErr: nil},
+		{input: "commitcost 1", wantErr: errInvalidNumArguments},
+		{input: "check", wantErr: nil},
+		{input: "check 1", wantErr: errInvalidNumArguments},
+		{input: "metrics", wantErr: nil},
+		{input: "metrics --prom", wantErr: nil},
+		{input: "metrics --prom 1", wantErr: errInvalidNumArguments},
+		{input: "keyhistory a", wantErr: nil},
+		{input: "keyhistory", wantErr: errInvalidNumArguments},
+		{input: "resettx", wantErr: nil},
+		{input: "resettx 1", wantErr: errInvalidNumArguments},
+		{input: "checkpoint a", wantErr: nil},
+		{input: "checkpoint", wantErr: errInvalidNumArguments},
+		{input: "restorecheckpoint a", wantErr: nil},
+		{input: "restorecheckpoint", wantErr: errInvalidNumArguments},
+		{input: "tree", wantErr: nil},
+		{input: "tree a", wantErr: errInvalidNumArguments},
+		{input: "mergefile f", wantErr: nil},
+		{input: "mergefile", wantErr: errInvalidNumArguments},
+		{input: "list", wantErr: nil},
+		{input: "list 1 2", wantErr: nil},
+		{input: "list 1 2 3", wantErr: errInvalidNumArguments},
+		{input: "dirty", wantErr: nil},
+		{input: "dirty a", wantErr: errInvalidNumArguments},
+		{input: "compact", wantErr: nil},
+		{input: "compact a", wantErr: errInvalidNumArguments},
+		{input: "readall", wantErr: nil},
+		{input: "readall a", wantErr: errInvalidNumArguments},
+		{input: "eq a b", wantErr: nil},
+		{input: "eq a", wantErr: errInvalidNumArguments},
+		{input: "assert a 1", wantErr: nil},
+		{input: "assert a", wantErr: errInvalidNumArguments},
+		{input: "grep ^a", wantErr: nil},
+		{input: "grep", wantErr: errInvalidNumArguments},
+		{input: "renameprefix a b", wantErr: nil},
+		{input: "renameprefix a", wantErr: errInvalidNumArguments},
+		{input: "copyprefix a b", wantErr: nil},
+		{input: "copyprefix a", wantErr: errInvalidNumArguments},
+		{input: "flatten", wantErr: nil},
+		{input: "flatten a", wantErr: errInvalidNumArguments},
+		{input: "mgetprefix user:", wantErr: nil},
+		{input: "mgetprefix", wantErr: errInvalidNumArguments},
+		{input: "committiming", wantErr: nil},
+		{input: "committiming a", wantErr: errInvalidNumArguments},
+		{input: "verify a 2cf24dba", wantErr: nil},
+		{input: "verify a", wantErr: errInvalidNumArguments},
+		{input: "storehash", wantErr: nil},
+		{input: "storehash a", wantErr: errInvalidNumArguments},
+		{input: "sleep 10", wantErr: nil},
+		{input: "sleep", wantErr: errInvalidNumArguments},
+		{input: "savepoint one", wantErr: nil},
+		{input: "rollbackto one", wantErr: nil},
+		{input: "savepoints", wantErr: nil},
+		{input: "savepoints one", wantErr: errInvalidNumArguments},
+		{input: "txsizes", wantErr: nil},
+		{input: "txsizes a", wantErr: errInvalidNumArguments},
+		{input: "autocommit off", wantErr: nil},
+		{input: "autocommit", wantErr: errInvalidNumArguments},
+		{input: "stats", wantErr: nil},
+		{input: "stats --json", wantErr: nil},
+		{input: "stats --json a", wantErr: errInvalidNumArguments},
+		{input: "truncate a 2", wantErr: nil},
+		{input: "truncate a", wantErr: errInvalidNumArguments},
+		{input: "replace a b c", wantErr: nil},
+		{input: "replace a b", wantErr: errInvalidNumArguments},
+		{input: "reverse a", wantErr: nil},
+		{input: "reverse", wantErr: errInvalidNumArguments},
+		{input: "upper a", wantErr: nil},
+		{input: "lower", wantErr: errInvalidNumArguments},
+		{input: "inspect a", wantErr: nil},
+		{input: "inspect", wantErr: errInvalidNumArguments},
+		{input: "writeenv a HOME", wantErr: nil},
+		{input: "writeenv a", wantErr: errInvalidNumArguments},
+		{input: "exportprefix user: f", wantErr: nil},
+		{input: "exportprefix user:", wantErr: errInvalidNumArguments},
+		{input: "countvalues", wantErr: nil},
+		{input: "countvalues a", wantErr: errInvalidNumArguments},
+		{input: "lenhist", wantErr: nil},
+		{input: "lenhist a", wantErr: errInvalidNumArguments},
+		{input: "top 3", wantErr: nil},
+		{input: "top", wantErr: errInvalidNumArguments},
+		{input: "importjson f.json", wantErr: nil},
+		{input: "importjson", wantErr: errInvalidNumArguments},
+		{input: "exportjson f.json", wantErr: nil},
+		{input: "exportjson", wantErr: errInvalidNumArguments},
+		{input: "difffiles a.snap b.snap", wantErr: nil},
+		{input: "difffiles a.snap", wantErr: errInvalidNumArguments},
+		{input: "patch p.diff", wantErr: nil},
+		{input: "patch", wantErr: errInvalidNumArguments},
+		{input: "flush", wantErr: nil},
+		{input: "flush a", wantErr: errInvalidNumArguments},
+		{input: "readat a 3", wantErr: nil},
+		{input: "readat a", wantErr: errInvalidNumArguments},
+		{input: "lastseq", wantErr: nil},
+		{input: "lastseq 1", wantErr: errInvalidNumArguments},
+		{input: "sortbyvalue", wantErr: nil},
+		{input: "sortbyvalue a", wantErr: errInvalidNumArguments},
+		{input: "deletematching ^a", wantErr: nil},
+		{input: "deletematching", wantErr: errInvalidNumArguments},
+		{input: "writehex a 00ff", wantErr: nil},
+		{input: "writehex a", wantErr: errInvalidNumArguments},
+		{input: "readhex a", wantErr: nil},
+		{input: "readhex", wantErr: errInvalidNumArguments},
+		{input: "writeb64 a AP8=", wantErr: nil},
+		{input: "writeb64 a", wantErr: errInvalidNumArguments},
+		{input: "readb64 a", wantErr: nil},
+		{input: "readb64", wantErr: errInvalidNumArguments},
+		{input: "info", wantErr: nil},
+		{input: "info a", wantErr: errInvalidNumArguments},
+		{input: "exportlog f.log", wantErr: nil},
+		{input: "exportlog", wantErr: errInvalidNumArguments},
+		{input: "importlog f.log", wantErr: nil},
+		{input: "importlog", wantErr: errInvalidNumArguments},
+		{input: "classify", wantErr: nil},
+		{input: "classify a", wantErr: errInvalidNumArguments},
+		{input: "completion bash", wantErr: nil},
+		{input: "completion", wantErr: errInvalidNumArguments},
+		{input: "source a.kv", wantErr: nil},
+		{input: "source", wantErr: errInvalidNumArguments},
+		{input: "parse write a b c d", wantErr: nil},
+		{input: "parse", wantErr: errInvalidNumArguments},
+		{input: "explain a", wantErr: nil},
+		{input: "explain", wantErr: errInvalidNumArguments},
 		{input: "exit", wantErr: nil},
+		{input: "set timing on", wantErr: nil},
+		{input: "set timing", wantErr: errInvalidNumArguments},
+		{input: "version", wantErr: nil},
+		{input: "version 1", wantErr: errInvalidNumArguments},
 		{input: "exit 4", wantErr: errInvalidNumArguments},
 	}
 
 	for _, tc := range cases {
-		_, _, _, err := r.parse(tc.input)
+		_, _, err := r.parse(tc.input)
 
 		if !errors.Is(err, tc.wantErr) {
 			t.Errorf("\nGot Error '%s' want '%s'", err, tc.wantErr)
@@ -52,7 +201,7 @@ func TestParse(t *testing.T) {
 	store := &storage.Store{}
 	r := NewRepl(store)
 
-	cmd, key, val, err := r.parse("write a hi")
+	cmd, args, err := r.parse("write a hi")
 
 	if err != nil {
 		t.Errorf("\nGot Error '%s' want 'nil'", err)
@@ -62,11 +211,406 @@ func TestParse(t *testing.T) {
 		t.Errorf("\nGot cmd '%s' want '%s'", cmd, wantCmd)
 	}
 
-	if key != wantKey {
-		t.Errorf("\nGot key '%s' want '%s'", key, wantKey)
+	if len(args) != 2 {
+		t.Fatalf("\nGot %d args want 2", len(args))
 	}
 
-	if val != wantVal {
-		t.Errorf("\nGot cmd '%s' want '%s'", val, wantVal)
+	if args[0] != wantKey {
+		t.Errorf("\nGot key '%s' want '%s'", args[0], wantKey)
+	}
+
+	if args[1] != wantVal {
+		t.Errorf("\nGot cmd '%s' want '%s'", args[1], wantVal)
+	}
+}
+
+func TestBatchErrorLine(t *testing.T) {
+	script := "write a 1\n" +
+		"\n" +
+		"read a\n" +
+		"remove b\n" +
+		"read a b\n"
+
+	var out, errOut bytes.Buffer
+	r := NewRepl(storage.NewStore(),
+		WithInput(strings.NewReader(script)),
+		WithOutput(&out),
+		WithErrOutput(&errOut),
+		WithBatch())
+	r.Run()
+
+	wantOut := "1\n"
+	if out.String() != wantOut {
+		t.Errorf("\nGot output '%s' want '%s'", out.String(), wantOut)
+	}
+
+	wantErr := "line 4: Key not found: b (remove b)\n" +
+		"line 5: Invalid Number of arguments: READ (required: 1) (read a b)\n"
+	if errOut.String() != wantErr {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut.String(), wantErr)
+	}
+}
+
+func TestBatchStrict(t *testing.T) {
+	script := "write a 1\n" +
+		"remove b\n" +
+		"read a\n"
+
+	cases := []struct {
+		strict   bool
+		wantCode int
+		wantOut  string
+	}{
+		{strict: false, wantCode: 0, wantOut: "1\n"},
+		{strict: true, wantCode: 1, wantOut: ""},
+	}
+
+	for _, tc := range cases {
+		var out, errOut bytes.Buffer
+		opts := []Option{
+			WithInput(strings.NewReader(script)),
+			WithOutput(&out),
+			WithErrOutput(&errOut),
+			WithBatch(),
+		}
+
+		if tc.strict {
+			opts = append(opts, WithStrict())
+		}
+
+		code := NewRepl(storage.NewStore(), opts...).Run()
+
+		if code != tc.wantCode {
+			t.Errorf("\nGot exit code '%d' want '%d' (strict: %t)", code, tc.wantCode, tc.strict)
+		}
+
+		if out.String() != tc.wantOut {
+			t.Errorf("\nGot output '%s' want '%s' (strict: %t)", out.String(), tc.wantOut, tc.strict)
+		}
+
+		wantErr := "line 2: Key not found: b (remove b)\n"
+		if errOut.String() != wantErr {
+			t.Errorf("\nGot errors '%s' want '%s' (strict: %t)", errOut.String(), wantErr, tc.strict)
+		}
+	}
+}
+
+func TestAssertStrict(t *testing.T) {
+	script := "write a 1\n" +
+		"assert a 1\n" +
+		"assert a 2\n" +
+		"read a\n"
+
+	out, errOut := run(script, WithBatch(), WithStrict())
+
+	if out != "" {
+		t.Errorf("\nGot output '%s' want ''", out)
+	}
+
+	wantErr := "line 3: Assertion failed: a: got \"1\", want \"2\" (assert a 2)\n"
+	if errOut != wantErr {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut, wantErr)
+	}
+}
+
+func TestParseKeepsArgumentCase(t *testing.T) {
+	r := NewRepl(storage.NewStore())
+
+	cmd, args, err := r.parse("SNAPSHOT /tmp/Store.snapshot")
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if cmd != "snapshot" {
+		t.Errorf("\nGot cmd '%s' want 'snapshot'", cmd)
+	}
+
+	if args[0] != "/tmp/Store.snapshot" {
+		t.Errorf("\nGot arg '%s' want '/tmp/Store.snapshot'", args[0])
+	}
+}
+
+// run runs the repl with the options opts over the input script, and returns
+// its output and error output.
+func run(script string, opts ...Option) (string, string) {
+	var out, errOut bytes.Buffer
+	opts = append([]Option{
+		WithInput(strings.NewReader(script)),
+		WithOutput(&out),
+		WithErrOutput(&errOut),
+	}, opts...)
+
+	NewRepl(storage.NewStore(), opts...).Run()
+	return out.String(), errOut.String()
+}
+
+func TestWriteStdin(t *testing.T) {
+	value := "first line\n  indented  line\n\nlast line"
+	script := "writestdin a\n" +
+		value + "\n" +
+		".\n" +
+		"read a\n" +
+		"read missing\n" +
+		"writestdin b\n" +
+		"never terminated\n"
+
+	out, errOut := run(script, WithBatch())
+
+	if out != value+"\n" {
+		t.Errorf("\nGot output '%s' want '%s'", out, value+"\n")
+	}
+
+	wantErr := "line 8: Key not found: missing (read missing)\n" +
+		"line 9: Value not terminated (writestdin b)\n"
+	if errOut != wantErr {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut, wantErr)
+	}
+}
+
+func TestAck(t *testing.T) {
+	script := "write a 1\n" +
+		"begin\n" +
+		"read a\n" +
+		"remove b\n" +
+		"commit\n" +
+		"begin\n" +
+		"discard\n"
+
+	cases := []struct {
+		opts    []Option
+		wantOut string
+	}{
+		{opts: nil, wantOut: "1\n"},
+		{opts: []Option{WithAck()}, wantOut: "OK\nOK\n1\nOK\nOK\nOK\n"},
+	}
+
+	for _, tc := range cases {
+		out, _ := run(script, append(tc.opts, WithBatch())...)
+		if out != tc.wantOut {
+			t.Errorf("\nGot output '%s' want '%s'", out, tc.wantOut)
+		}
+	}
+}
+
+func TestAckJSON(t *testing.T) {
+	out, _ := run("set json on\nwrite a 1\n", WithAck(), WithBatch())
+
+	wantOut := "{\"ok\":true}\n"
+	if out != wantOut {
+		t.Errorf("\nGot output '%s' want '%s'", out, wantOut)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	advance := func(d time.Duration) { now = now.Add(d) }
+
+	script := "setex a 1 hi\n" +
+		"sleep 999\n" +
+		"read a\n" +
+		"sleep 1\n" +
+		"read a\n" +
+		"sleep -1\n" +
+		"sleep ten\n" +
+		"sleep 9223372036855\n"
+
+	var out, errOut bytes.Buffer
+	NewRepl(storage.NewStore(storage.WithClock(clock)),
+		WithInput(strings.NewReader(script)),
+		WithOutput(&out),
+		WithErrOutput(&errOut),
+		WithBatch(),
+		WithSleep(advance),
+	).Run()
+
+	if out.String() != "hi\n" {
+		t.Errorf("\nGot output '%s' want 'hi\\n'", out.String())
+	}
+
+	wantErr := "line 5: Key not found: a (read a)\n" +
+		"line 6: Invalid argument: milliseconds -1 (minimum 0) (sleep -1)\n" +
+		"line 7: Invalid argument: milliseconds ten (integer required) (sleep ten)\n" +
+		"line 8: Invalid argument: milliseconds 9223372036855 (maximum 9223372036854) (sleep 9223372036855)\n"
+	if errOut.String() != wantErr {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut.String(), wantErr)
+	}
+
+	if want := time.Unix(1, 0); !now.Equal(want) {
+		t.Errorf("\nGot clock at '%s' want '%s'", now, want)
+	}
+}
+
+func TestSleepStrictError(t *testing.T) {
+	r := NewRepl(storage.NewStore(),
+		WithInput(strings.NewReader("sleep ten\n")),
+		WithOutput(io.Discard),
+		WithErrOutput(io.Discard),
+		WithBatch(),
+		WithStrict(),
+	)
+
+	if err := r.loop(); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Errorf("\nGot error '%v' want '%v'", err, storage.ErrInvalidArgument)
+	}
+}
+
+func TestInit(t *testing.T) {
+	setup := "write a 1\n" +
+		"\n" +
+		"remove b\n" +
+		"write b 2\n"
+
+	script := "read a\n" +
+		"read b\n" +
+		"remove c\n"
+
+	out, errOut := run(script, WithInit(strings.NewReader(setup)))
+
+	wantOut := "> 1\n> 2\n> > "
+	if out != wantOut {
+		t.Errorf("\nGot output '%s' want '%s'", out, wantOut)
+	}
+
+	// the init errors are reported as in batch mode, the input ones are not.
+	wantErr := "line 3: Key not found: b (remove b)\n" +
+		"Key not found: c\n"
+	if errOut != wantErr {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut, wantErr)
+	}
+}
+
+func TestInitExit(t *testing.T) {
+	out, _ := run("read a\n", WithInit(strings.NewReader("write a 1\nexit\n")))
+
+	if out != "" {
+		t.Errorf("\nGot output '%s' want ''", out)
+	}
+}
+
+func TestShebang(t *testing.T) {
+	script := "#!/usr/bin/env kvrepl\n" +
+		"write a 1\n" +
+		"read a\n" +
+		"#!not a shebang\n"
+
+	out, errOut := run(script, WithBatch())
+
+	if out != "1\n" {
+		t.Errorf("\nGot output '%s' want '1\\n'", out)
+	}
+
+	wantErr := "line 4: Unsupported command: #!not (#!not a shebang)\n"
+	if errOut != wantErr {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut, wantErr)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	script := "write a 1\n" +
+		"\n" +
+		"read a\n" +
+		"read b\n" +
+		"writestdin b\n" +
+		"two\n" +
+		"lines\n" +
+		".\n" +
+		"read b\n"
+
+	out, errOut := run(script, WithEcho(), WithBatch())
+
+	wantOut := ">> write a 1\n" +
+		">> read a\n" +
+		"1\n" +
+		">> read b\n" +
+		">> writestdin b\n" +
+		">> read b\n" +
+		"two\nlines\n"
+	if out != wantOut {
+		t.Errorf("\nGot output '%s' want '%s'", out, wantOut)
+	}
+
+	wantErrOut := "line 4: Key not found: b (read b)\n"
+	if errOut != wantErrOut {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut, wantErrOut)
+	}
+}
+
+func TestLongLine(t *testing.T) {
+	value := strings.Repeat("0123456789", 500000)
+
+	out, errOut := run("write a "+value+"\nread a\n", WithBatch())
+
+	if errOut != "" {
+		t.Fatalf("\nGot errors '%s' want none", errOut)
+	}
+
+	if out != value+"\n" {
+		t.Errorf("\nGot value of %d bytes want %d", len(out)-1, len(value))
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		"",
+		" ",
+		"\t\n",
+		"write a 1",
+		"WRITE a 1",
+		"write  a   1 ",
+		"write a",
+		"write a 1 2",
+		"setex a 10 hi",
+		"metrics --prom",
+		"metrics --prom 1",
+		"read \"a b\"",
+		"read 'a",
+		"\x00 \xff",
+		"ünïcödé a",
+		"set prompt kv>",
+		"exit",
+	}
+
+	for _, s := range seeds {
+		f.Add(s)
+	}
+
+	r := NewRepl(storage.NewStore())
+	f.Fuzz(func(t *testing.T, in string) {
+		cmd, args, err := r.parse(in)
+		if err != nil {
+			if !errors.Is(err, errNoCommand) && !errors.Is(err, errUnsupportedCommand) && !errors.Is(err, errInvalidNumArguments) {
+				t.Errorf("\nGot undefined Error '%s' for input '%q'", err, in)
+			}
+
+			return
+		}
+
+		required, ok := validCommands[cmd]
+		if !ok {
+			t.Fatalf("\nGot unregistered command '%s' for input '%q'", cmd, in)
+		}
+
+		if n := len(args); n < required || n > required+optionalArgs[cmd] {
+			t.Errorf("\nGot %d args for command '%s' for input '%q'", n, cmd, in)
+		}
+	})
+}
+
+func TestAutoCommitOffAtomicCommands(t *testing.T) {
+	script := "write a1 x\n" +
+		"autocommit off\n" +
+		"renameprefix a b\n" +
+		"discard\n" +
+		"read a1\n" +
+		"read b1\n"
+	out, errOut := run(script, WithBatch())
+
+	if out != "1\nx\n" {
+		t.Errorf("\nGot output '%s' want '1\\nx\\n'", out)
+	}
+
+	if errOut != "line 6: Key not found: b1 (read b1)\n" {
+		t.Errorf("\nGot errors '%s' want the missing b1 only", errOut)
 	}
 }
@@ -0,0 +1,42 @@
+package repl
+
+import (
+	"fmt"
+	"github.com/caasmo/kv-repl-barebones/storage"
+)
+
+// confirmPrompt asks for the confirmation of a destructive command in safe
+// mode. Only confirmYes confirms it.
+const (
+	confirmPrompt = "Are you sure? (yes/no)"
+	confirmYes    = "yes"
+)
+
+// destructiveCommands are the commands that discard data, or overwrite the
+// committed data outside any transaction, and require a confirmation in safe
+// mode.
+var destructiveCommands = map[string]bool{
+	storage.ResetTx:           true,
+	storage.RestoreFile:       true,
+	storage.RestoreCheckpoint: true,
+	storage.ImportLog:         true,
+	storage.MergeFile:         true,
+	storage.ImportJSON:        true,
+}
+
+// WithSafe makes the repl ask for confirmation before running a destructive
+// command, like restore or resettx, in interactive mode. The command runs only
+// if the answer is yes. Scripts are not affected.
+func WithSafe() Option {
+	return func(r *repl) {
+		r.safe = true
+	}
+}
+
+// confirm prompts for the confirmation of a destructive command and reads the
+// answer from the input. It returns true if the answer is yes.
+func (r *repl) confirm() bool {
+	fmt.Fprint(r.out, confirmPrompt+" ")
+	answer, err := r.read()
+	return err == nil && answer == confirmYes
+}
@@ -0,0 +1,92 @@
+package repl
+
+import (
+	"testing"
+)
+
+func TestSafe(t *testing.T) {
+	script := "write a 1\n" +
+		"checkpoint c\n" +
+		"write a 2\n" +
+		"restorecheckpoint c\n" +
+		"no\n" +
+		"read a\n" +
+		"restorecheckpoint c\n" +
+		"yes\n" +
+		"read a\n"
+
+	out, errOut := run(script, WithSafe())
+
+	ask := confirmPrompt + " "
+	wantOut := "> > > > " + ask + "> 2\n> " + ask + "> 1\n> "
+	if out != wantOut {
+		t.Errorf("\nGot output '%q' want '%q'", out, wantOut)
+	}
+
+	wantErrOut := errAborted.Error() + "\n"
+	if errOut != wantErrOut {
+		t.Errorf("\nGot errors '%q' want '%q'", errOut, wantErrOut)
+	}
+}
+
+func TestSafeBatch(t *testing.T) {
+	script := "write a 1\n" +
+		"checkpoint c\n" +
+		"write a 2\n" +
+		"restorecheckpoint c\n" +
+		"read a\n"
+
+	out, errOut := run(script, WithSafe(), WithBatch())
+
+	if out != "1\n" {
+		t.Errorf("\nGot output '%q' want '%q'", out, "1\n")
+	}
+
+	if errOut != "" {
+		t.Errorf("\nGot errors '%q' want none", errOut)
+	}
+}
+
+func TestNotSafe(t *testing.T) {
+	out, errOut := run("write a 1\nbegin\nresettx\nread a\n")
+
+	// resettx prints the number of transactions discarded
+	wantOut := "> > > 1\n> 1\n> "
+	if out != wantOut {
+		t.Errorf("\nGot output '%q' want '%q'", out, wantOut)
+	}
+
+	if errOut != "" {
+		t.Errorf("\nGot errors '%q' want none", errOut)
+	}
+}
+
+func TestSafeImportLog(t *testing.T) {
+	out, errOut := run("write a 1\nimportlog reset.log\nno\nread a\n", WithSafe())
+
+	wantOut := "> > " + confirmPrompt + " > 1\n> "
+	if out != wantOut {
+		t.Errorf("\nGot output '%q' want '%q'", out, wantOut)
+	}
+
+	wantErrOut := errAborted.Error() + "\n"
+	if errOut != wantErrOut {
+		t.Errorf("\nGot errors '%q' want '%q'", errOut, wantErrOut)
+	}
+}
+
+func TestSafeMerges(t *testing.T) {
+	for _, cmd := range []string{"mergefile a.snap", "importjson a.json"} {
+		out, errOut := run("write a 1\n"+cmd+"\nno\nread a\n", WithSafe())
+
+		wantOut := "> > " + confirmPrompt + " > 1\n> "
+		if out != wantOut {
+			t.Errorf("\nGot output '%q' want '%q' for %s", out, wantOut, cmd)
+		}
+
+		wantErrOut := errAborted.Error() + "\n"
+		if errOut != wantErrOut {
+			t.Errorf("\nGot errors '%q' want '%q' for %s", errOut, wantErrOut, cmd)
+		}
+	}
+}
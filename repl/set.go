@@ -0,0 +1,57 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errUnknownOption      error = errors.New("Unknown option")
+	errInvalidOptionValue error = errors.New("Invalid option value")
+)
+
+// set sets the repl option name to value. The options are:
+//
+//	timing on|off  print the time taken by each command
+//	json on|off    print results and errors as JSON objects
+//	ack on|off     acknowledge the commands without output with OK
+//	prompt <text>  the prompt of the interactive mode
+//	format raw|json-pretty
+//	               how read renders the values
+func (r *repl) set(name, value string) error {
+	switch name {
+	case "timing":
+		return setOnOff(&r.timing, name, value)
+	case "json":
+		return setOnOff(&r.json, name, value)
+	case "ack":
+		return setOnOff(&r.ack, name, value)
+	case "prompt":
+		r.promptText = value
+		return nil
+	case "format":
+		if value != formatRaw && value != formatJSONPretty {
+			return fmt.Errorf("%w: %s %s (%s|%s)", errInvalidOptionValue, name, value, formatRaw, formatJSONPretty)
+		}
+
+		r.format = value
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", errUnknownOption, name)
+}
+
+// setOnOff sets the flag option name to true for the value on and to false
+// for off.
+func setOnOff(option *bool, name, value string) error {
+	switch value {
+	case "on":
+		*option = true
+	case "off":
+		*option = false
+	default:
+		return fmt.Errorf("%w: %s %s (on|off)", errInvalidOptionValue, name, value)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package repl
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSetTiming(t *testing.T) {
+	script := "write a 1\n" +
+		"read a\n" +
+		"set timing on\n" +
+		"read a\n" +
+		"set timing off\n" +
+		"read a\n"
+
+	out, _ := run(script, WithBatch())
+
+	re := regexp.MustCompile(`^1\n1\ntime: \S+\n1\n$`)
+	if !re.MatchString(out) {
+		t.Errorf("\nGot output '%s' want '%s'", out, re)
+	}
+}
+
+func TestSetJSON(t *testing.T) {
+	script := "write a 1\n" +
+		"set json on\n" +
+		"read a\n" +
+		"read b\n" +
+		"set json off\n" +
+		"read a\n" +
+		"read b\n"
+
+	out, errOut := run(script)
+
+	wantOut := "> > > {\"result\":\"1\"}\n> > > 1\n> > "
+	if out != wantOut {
+		t.Errorf("\nGot output '%s' want '%s'", out, wantOut)
+	}
+
+	wantErr := "{\"error\":\"Key not found: b\"}\nKey not found: b\n"
+	if errOut != wantErr {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut, wantErr)
+	}
+}
+
+func TestSetJSONBatch(t *testing.T) {
+	_, errOut := run("set json on\nread b\n", WithBatch())
+
+	wantErr := "{\"error\":\"Key not found: b\",\"input\":\"read b\",\"line\":2}\n"
+	if errOut != wantErr {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut, wantErr)
+	}
+}
+
+func TestSetPrompt(t *testing.T) {
+	out, _ := run("set prompt kv>\nwrite a 1\n")
+
+	wantOut := "> kv> kv> "
+	if out != wantOut {
+		t.Errorf("\nGot output '%s' want '%s'", out, wantOut)
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	script := `write a {"name":"Bob","tags":[1,2]}` + "\n" +
+		"write b 42\n" +
+		"write c {not-json\n" +
+		"read a\n" +
+		"set format json-pretty\n" +
+		"read a\n" +
+		"read b\n" +
+		"read c\n" +
+		"set format raw\n" +
+		"read a\n"
+
+	out, errOut := run(script, WithBatch())
+
+	if errOut != "" {
+		t.Fatalf("\nGot errors '%s' want none", errOut)
+	}
+
+	raw := `{"name":"Bob","tags":[1,2]}` + "\n"
+	pretty := "{\n" +
+		"  \"name\": \"Bob\",\n" +
+		"  \"tags\": [\n" +
+		"    1,\n" +
+		"    2\n" +
+		"  ]\n" +
+		"}\n"
+	wantOut := raw + pretty + "42\n" + "{not-json\n" + raw
+	if out != wantOut {
+		t.Errorf("\nGot output '%s' want '%s'", out, wantOut)
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	_, errOut := run("set colors on\nset timing yes\nset format xml\n")
+
+	lines := strings.Split(strings.TrimSpace(errOut), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("\nGot errors '%s' want 3 lines", errOut)
+	}
+
+	if !strings.HasPrefix(lines[0], errUnknownOption.Error()) {
+		t.Errorf("\nGot Error '%s' want '%s'", lines[0], errUnknownOption)
+	}
+
+	if !strings.HasPrefix(lines[1], errInvalidOptionValue.Error()) {
+		t.Errorf("\nGot Error '%s' want '%s'", lines[1], errInvalidOptionValue)
+	}
+
+	if !strings.HasPrefix(lines[2], errInvalidOptionValue.Error()) {
+		t.Errorf("\nGot Error '%s' want '%s'", lines[2], errInvalidOptionValue)
+	}
+}
@@ -0,0 +1,63 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// maxSourceDepth is the maximum nesting of the source command. It stops the
+// scripts that source themselves, directly or not.
+const maxSourceDepth = 16
+
+var errSourceDepth error = errors.New("Source depth exceeded")
+
+// WithBaseDir makes the source command resolve the relative paths against dir
+// instead of the working directory.
+func WithBaseDir(dir string) Option {
+	return func(r *repl) {
+		r.baseDir = dir
+	}
+}
+
+// source runs the commands of the script file at path, given by the input in,
+// in batch mode on the same Store, and then restores the input, the mode and
+// the line count. Errors of the script are reported with its path, as given,
+// and its own line numbers.
+//
+// The file failing to open, or the sources nested over maxSourceDepth, are
+// errors of in. Like next, source returns errExit on the exit command of the
+// script and, in strict mode, the error of a failing command.
+func (r *repl) source(in, path string) error {
+	if r.sourceDepth >= maxSourceDepth {
+		return r.fail(in, fmt.Errorf("%w: %s (maximum %d)", errSourceDepth, path, maxSourceDepth))
+	}
+
+	name := path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.baseDir, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return r.fail(in, err)
+	}
+	defer f.Close()
+
+	input, batch, line, file := r.in, r.batch, r.line, r.sourceFile
+	defer func() {
+		r.in, r.batch, r.line, r.sourceFile = input, batch, line, file
+		r.sourceDepth--
+	}()
+
+	r.in, r.batch, r.line, r.sourceFile = bufio.NewReader(f), true, 0, name
+	r.sourceDepth++
+	if err := r.loop(); !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScript writes the script content to the file name in dir.
+func writeScript(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSourceNested(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "outer.kv", "write a 1\nsource inner.kv\nread b\nread missing\n")
+	writeScript(t, dir, "inner.kv", "write b 2\n\nread a\n")
+
+	script := "source outer.kv\n" +
+		"read a\n" +
+		"source nope.kv\n"
+	out, errOut := run(script, WithBatch(), WithBaseDir(dir))
+
+	wantOut := "1\n2\n1\n"
+	if out != wantOut {
+		t.Errorf("\nGot output '%s' want '%s'", out, wantOut)
+	}
+
+	// the errors of outer.kv have its path and line numbers, the input lines
+	// are back to the script ones after the source.
+	lines := strings.Split(strings.TrimSuffix(errOut, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("\nGot errors '%s' want 2", errOut)
+	}
+
+	if lines[0] != "outer.kv line 4: Key not found: missing (read missing)" {
+		t.Errorf("\nGot error '%s' want the line 4 of outer.kv", lines[0])
+	}
+
+	if !strings.HasPrefix(lines[1], "line 3: open ") {
+		t.Errorf("\nGot error '%s' want the open error of line 3", lines[1])
+	}
+}
+
+func TestSourceInteractive(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "setup.kv", "write a 1\n")
+
+	out, errOut := run("source " + filepath.Join(dir, "setup.kv") + "\nread a\n")
+
+	if errOut != "" {
+		t.Errorf("\nGot errors '%s' want none", errOut)
+	}
+
+	// the sourced commands print no prompt.
+	if out != "> > 1\n> " {
+		t.Errorf("\nGot output '%q' want '%q'", out, "> > 1\n> ")
+	}
+}
+
+func TestSourceDepth(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "a.kv", "source b.kv\n")
+	writeScript(t, dir, "b.kv", "begin\nsource a.kv\n")
+
+	out, errOut := run("source a.kv\ntxkeys\n", WithBatch(), WithBaseDir(dir))
+
+	if strings.Count(errOut, errSourceDepth.Error()) != 1 {
+		t.Errorf("\nGot errors '%s' want one '%s'", errOut, errSourceDepth)
+	}
+
+	if out != "" {
+		t.Errorf("\nGot output '%s' want none", out)
+	}
+}
+
+func TestSourceExit(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "exit.kv", "write a 1\nexit\nwrite b 2\n")
+
+	out, errOut := run("source exit.kv\nread a\n", WithBatch(), WithBaseDir(dir))
+
+	if out != "" || errOut != "" {
+		t.Errorf("\nGot output '%s' and errors '%s' want none", out, errOut)
+	}
+}
+
+func TestSourceStrict(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "fail.kv", "read missing\nwrite a 1\n")
+
+	out, errOut := run("source fail.kv\nread a\n", WithBatch(), WithStrict(), WithBaseDir(dir))
+
+	if out != "" {
+		t.Errorf("\nGot output '%s' want none", out)
+	}
+
+	if errOut != "fail.kv line 1: Key not found: missing (read missing)\n" {
+		t.Errorf("\nGot errors '%s' want the error of fail.kv only", errOut)
+	}
+}
+
+func TestSourceErrorFile(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "outer.kv", "source inner.kv\nread missing\n")
+	writeScript(t, dir, "inner.kv", "write a 1\nread nope\n")
+
+	_, errOut := run("source outer.kv\nread none\n", WithBatch(), WithBaseDir(dir))
+
+	want := "inner.kv line 2: Key not found: nope (read nope)\n" +
+		"outer.kv line 2: Key not found: missing (read missing)\n" +
+		"line 2: Key not found: none (read none)\n"
+	if errOut != want {
+		t.Errorf("\nGot errors '%s' want '%s'", errOut, want)
+	}
+}
@@ -0,0 +1,77 @@
+package repl
+
+import (
+	"sort"
+)
+
+// maxSuggestDistance is the maximum edit distance between an unknown command
+// and a suggested one.
+const maxSuggestDistance = 2
+
+// suggest returns the valid command closest to the unknown command in, by
+// Levenshtein distance, or an empty string if none is close enough. Ties are
+// broken alphabetically.
+func suggest(in string) string {
+	cmds := make([]string, 0, len(validCommands))
+	for cmd := range validCommands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+
+	best, bestDistance := "", maxSuggestDistance+1
+	for _, cmd := range cmds {
+		if d := levenshtein(in, cmd); d < bestDistance {
+			best, bestDistance = cmd, d
+		}
+	}
+
+	// a distance as long as the input replaces it entirely.
+	if bestDistance >= len([]rune(in)) {
+		return ""
+	}
+
+	return best
+}
+
+// levenshtein returns the minimum number of single character insertions,
+// deletions and substitutions to change a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// prev and curr are the distances from a prefix of a to each prefix of b.
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// min3 returns the minimum of a, b and c.
+func min3(a, b, c int) int {
+	m := a
+	if b < m {
+		m = b
+	}
+
+	if c < m {
+		m = c
+	}
+
+	return m
+}
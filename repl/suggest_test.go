@@ -0,0 +1,61 @@
+package repl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{input: "writ", want: "write"},
+		{input: "raed", want: "read"},
+		{input: "comit", want: "commit"},
+		{input: "begn", want: "begin"},
+		{input: "discrad", want: "discard"},
+		{input: "exti", want: "exit"},
+		{input: "xyzzy", want: ""},
+		{input: "ab", want: ""},
+	}
+
+	for _, tc := range cases {
+		if got := suggest(tc.input); got != tc.want {
+			t.Errorf("\nGot suggestion '%s' want '%s' (input: %s)", got, tc.want, tc.input)
+		}
+	}
+}
+
+func TestSuggestError(t *testing.T) {
+	r := NewRepl(nil)
+
+	_, _, err := r.parse("writ a 1")
+	if !errors.Is(err, errUnsupportedCommand) {
+		t.Fatalf("\nGot Error '%v' want '%s'", err, errUnsupportedCommand)
+	}
+
+	want := "Unsupported command: writ (did you mean 'write'?)"
+	if err.Error() != want {
+		t.Errorf("\nGot Error '%s' want '%s'", err, want)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "abc", want: 3},
+		{a: "abc", b: "abc", want: 0},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "raed", b: "read", want: 2},
+	}
+
+	for _, tc := range cases {
+		if got := levenshtein(tc.a, tc.b); got != tc.want {
+			t.Errorf("\nGot distance %d want %d (%s, %s)", got, tc.want, tc.a, tc.b)
+		}
+	}
+}
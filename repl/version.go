@@ -0,0 +1,47 @@
+package repl
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// readBuildInfo returns the build information of the binary. Replaced in
+// tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// Version returns the version of the binary, the Go version used to build it
+// and its VCS revision, one per line.
+func Version() string {
+	return renderVersion(readBuildInfo())
+}
+
+// renderVersion renders the build information info. ok is false if there is
+// no build information.
+func renderVersion(info *debug.BuildInfo, ok bool) string {
+	if !ok {
+		return "version: unknown"
+	}
+
+	revision, modified := "unknown", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+
+	if modified {
+		revision += " (modified)"
+	}
+
+	lines := []string{
+		fmt.Sprintf("version: %s", info.Main.Version),
+		fmt.Sprintf("go: %s", info.GoVersion),
+		fmt.Sprintf("revision: %s", revision),
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,70 @@
+package repl
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestRenderVersion(t *testing.T) {
+	cases := []struct {
+		info *debug.BuildInfo
+		ok   bool
+		want string
+	}{
+		{
+			info: &debug.BuildInfo{
+				GoVersion: "go1.18",
+				Main:      debug.Module{Version: "v1.2.3"},
+				Settings: []debug.BuildSetting{
+					{Key: "vcs", Value: "git"},
+					{Key: "vcs.revision", Value: "abc123"},
+					{Key: "vcs.modified", Value: "false"},
+				},
+			},
+			ok:   true,
+			want: "version: v1.2.3\ngo: go1.18\nrevision: abc123",
+		},
+		{
+			info: &debug.BuildInfo{
+				GoVersion: "go1.18",
+				Main:      debug.Module{Version: "(devel)"},
+				Settings: []debug.BuildSetting{
+					{Key: "vcs.revision", Value: "abc123"},
+					{Key: "vcs.modified", Value: "true"},
+				},
+			},
+			ok:   true,
+			want: "version: (devel)\ngo: go1.18\nrevision: abc123 (modified)",
+		},
+		{
+			info: &debug.BuildInfo{GoVersion: "go1.18", Main: debug.Module{Version: "(devel)"}},
+			ok:   true,
+			want: "version: (devel)\ngo: go1.18\nrevision: unknown",
+		},
+		{
+			info: nil,
+			ok:   false,
+			want: "version: unknown",
+		},
+	}
+
+	for _, tc := range cases {
+		if got := renderVersion(tc.info, tc.ok); got != tc.want {
+			t.Errorf("\nGot version '%s' want '%s'", got, tc.want)
+		}
+	}
+}
+
+func TestVersionCommand(t *testing.T) {
+	defer func(f func() (*debug.BuildInfo, bool)) { readBuildInfo = f }(readBuildInfo)
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{GoVersion: "go1.18", Main: debug.Module{Version: "v1.0.0"}}, true
+	}
+
+	out, _ := run("version\n", WithBatch())
+
+	want := "version: v1.0.0\ngo: go1.18\nrevision: unknown\n"
+	if out != want {
+		t.Errorf("\nGot output '%s' want '%s'", out, want)
+	}
+}
@@ -0,0 +1,487 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SyncPolicy defines when the AOF is synced to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the AOF after every operation.
+	SyncAlways SyncPolicy = iota
+
+	// SyncEverySec buffers the operations and syncs the AOF once per second
+	// and on Close.
+	SyncEverySec
+
+	// SyncNo hands every operation to the operating system, which decides
+	// when to sync.
+	SyncNo
+)
+
+var (
+	ErrInvalidSyncPolicy error = errors.New("Invalid sync policy")
+	ErrAOFNotEnabled     error = errors.New("AOF not enabled")
+	ErrAOFEnabled        error = errors.New("AOF already enabled")
+)
+
+// syncInterval is the interval between syncs of the SyncEverySec policy.
+const syncInterval = time.Second
+
+// String returns the name of the policy p.
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncEverySec:
+		return "everysec"
+	case SyncNo:
+		return "no"
+	}
+
+	return fmt.Sprintf("SyncPolicy(%d)", int(p))
+}
+
+// ParseSyncPolicy returns the policy with the name name: always, everysec or
+// no.
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	for _, p := range []SyncPolicy{SyncAlways, SyncEverySec, SyncNo} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrInvalidSyncPolicy, name)
+}
+
+// aofRecord is the representation of an operation in the append-only file
+// (AOF). The AOF contains one JSON encoded record per line, in the order the
+// operations were committed.
+type aofRecord struct {
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	IsWrite bool   `json:"write"`
+	IsNote  bool   `json:"note,omitempty"`
+
+	// ExpireAt is the expiration time in Unix nanoseconds. 0 means the key
+	// does not expire.
+	ExpireAt int64 `json:"expire_at,omitempty"`
+}
+
+// newAOFRecord returns the record of the operation op.
+func newAOFRecord(op operation) aofRecord {
+	r := aofRecord{Key: op.key, Value: op.value, IsWrite: op.isWrite, IsNote: op.isNote}
+	if !op.expireAt.IsZero() {
+		r.ExpireAt = op.expireAt.UnixNano()
+	}
+
+	return r
+}
+
+// operation returns the operation of the record r.
+func (r aofRecord) operation() operation {
+	op := operation{key: r.Key, value: r.Value, isWrite: r.IsWrite, isNote: r.IsNote}
+	if r.ExpireAt != 0 {
+		op.expireAt = time.Unix(0, r.ExpireAt)
+	}
+
+	return op
+}
+
+// aofWriter appends records to the AOF following its sync policy.
+//
+// The Store has a single client, but under SyncEverySec a background
+// goroutine syncs the buffer, so the writer needs locking.
+type aofWriter struct {
+	mu     sync.Mutex
+	f      *os.File
+	path   string
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	policy SyncPolicy
+
+	// done stops the background sync of SyncEverySec.
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// syncErr is the error of the last failed background sync, returned by
+	// the next append or close.
+	syncErr error
+}
+
+// newAOFWriter returns an aofWriter appending to the file f, at path, with
+// the sync policy policy.
+func newAOFWriter(f *os.File, path string, policy SyncPolicy) *aofWriter {
+	w := &aofWriter{f: f, path: path, buf: bufio.NewWriter(f), policy: policy}
+	w.enc = json.NewEncoder(w.buf)
+
+	if policy == SyncEverySec {
+		w.done = make(chan struct{})
+		w.wg.Add(1)
+		go w.syncEverySec()
+	}
+
+	return w
+}
+
+// syncEverySec syncs the AOF every syncInterval until done is closed.
+func (w *aofWriter) syncEverySec() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.backgroundSync()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// backgroundSync syncs the AOF and keeps the error, if any, for the next
+// append or close.
+func (w *aofWriter) backgroundSync() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.sync(); err != nil {
+		w.syncErr = err
+	}
+}
+
+// takeSyncErr returns the error of the last failed background sync, if any,
+// and clears it.
+func (w *aofWriter) takeSyncErr() error {
+	err := w.syncErr
+	w.syncErr = nil
+	return err
+}
+
+// sync flushes the buffer to the file and syncs the file to disk.
+func (w *aofWriter) sync() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+
+	return w.f.Sync()
+}
+
+// append appends the record r to the AOF.
+//
+// append returns the error of a failed background sync since the last append,
+// even if r itself is appended.
+func (w *aofWriter) append(r aofRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.enc.Encode(r); err != nil {
+		return err
+	}
+
+	switch w.policy {
+	case SyncAlways:
+		return w.sync()
+	case SyncNo:
+		return w.buf.Flush()
+	}
+
+	return w.takeSyncErr()
+}
+
+// close stops the background sync, if any, syncs the pending records and
+// closes the file. It returns the error of a failed background sync not yet
+// returned by append.
+func (w *aofWriter) close() error {
+	if w.done != nil {
+		close(w.done)
+		w.wg.Wait()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.takeSyncErr()
+	if syncErr := w.sync(); err == nil {
+		err = syncErr
+	}
+
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// EnableAOF enables the append-only file persistence. Every operation
+// committed to the kvStore from now on is appended to the file at path.
+// Operations in open transactions are only appended when committed to the
+// kvStore, so discarded transactions are never persisted. The policy defines
+// when the file is synced to disk.
+//
+// If the file exists, its operations are replayed first to reconstruct the
+// state. EnableAOF is meant to be called on a new Store.
+//
+// EnableAOF returns ErrAOFEnabled if the AOF is already enabled: Close it
+// first.
+func (s *Store) EnableAOF(path string, policy SyncPolicy) error {
+	if s.aof != nil {
+		return ErrAOFEnabled
+	}
+
+	err := s.replayAOF(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.aof = newAOFWriter(f, path, policy)
+	return nil
+}
+
+// replayAOF applies all operations of the AOF at path to the committed state.
+//
+// A final record without its newline was torn by a crash while appending: it
+// is logged, not applied, and truncated from the file, so the next appends
+// start on a new line. A record that does not decode is an error.
+func (s *Store) replayAOF(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rd := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("aof %s: %w", path, err)
+		}
+
+		if len(line) == 0 {
+			return nil
+		}
+
+		// every record ends with a newline, the append of this one was cut.
+		if err == io.EOF {
+			s.logger.Errorf("aof %s: truncating torn record at offset %d", path, offset)
+			return os.Truncate(path, offset)
+		}
+
+		var r aofRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("aof %s: record at offset %d: %w", path, offset, err)
+		}
+
+		if err := s.apply(r.operation()); err != nil {
+			return err
+		}
+
+		offset += int64(len(line))
+	}
+}
+
+// appendAOF appends the operation op to the AOF, if enabled and not paused.
+func (s *Store) appendAOF(op operation) error {
+	if s.aof == nil || s.aofPaused {
+		return nil
+	}
+
+	if err := s.aof.append(newAOFRecord(op)); err != nil {
+		return fmt.Errorf("aof: %w", err)
+	}
+
+	return nil
+}
+
+// CompactAOF writes to path an AOF with the minimal operations that
+// reconstruct the committed state: one write per live key, plus one per note.
+// The historical churn of the keys is discarded. If path is the enabled AOF,
+// whatever the path it was enabled with, it is replaced by the compacted one
+// and appending continues there.
+//
+// On error, the enabled AOF is left as it was, and appending continues there.
+func (s *Store) CompactAOF(path string) error {
+	live, err := s.isAOF(path)
+	if err != nil {
+		return err
+	}
+
+	// the file is replaced, not a symlink to it.
+	if live {
+		if path, err = filepath.EvalSymlinks(path); err != nil {
+			return err
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := s.writeCompactAOF(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if !live {
+		return os.Rename(tmp, path)
+	}
+
+	return s.swapAOF(tmp, path)
+}
+
+// isAOF reports whether the file at path is the enabled AOF. A missing file
+// is not.
+func (s *Store) isAOF(path string) (bool, error) {
+	if s.aof == nil {
+		return false, nil
+	}
+
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	aofInfo, err := s.aof.f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	return os.SameFile(fi, aofInfo), nil
+}
+
+// swapAOF replaces the enabled AOF at path with the compacted AOF at tmp, and
+// appends to it from now on. The compacted file is opened before the rename,
+// so that a failure keeps the enabled AOF and its writer.
+func (s *Store) swapAOF(tmp, path string) error {
+	f, err := os.OpenFile(tmp, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	// the compacted file has the committed state: the records still buffered
+	// by the old writer are only lost from the replaced file.
+	old := s.aof
+	s.aof = newAOFWriter(f, path, old.policy)
+	return old.close()
+}
+
+// writeCompactAOF writes the compacted AOF of the committed state to the file
+// at path. The keys are written in order.
+func (s *Store) writeCompactAOF(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	keys := make([]string, 0, len(s.kv))
+	for k, e := range s.kv {
+		if !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	w := newAOFWriter(f, path, SyncNo)
+	for _, k := range keys {
+		e := s.kv[k]
+		if err := w.append(newAOFRecord(operation{key: k, value: e.value, isWrite: true, expireAt: e.expireAt})); err != nil {
+			w.close()
+			return err
+		}
+
+		if note, ok := s.notes[k]; ok {
+			if err := w.append(newAOFRecord(operation{key: k, value: note, isWrite: true, isNote: true})); err != nil {
+				w.close()
+				return err
+			}
+		}
+	}
+
+	return w.close()
+}
+
+// rewriteAOF compacts the enabled AOF.
+//
+// rewriteAOF returns error if the AOF is not enabled.
+func (s *Store) rewriteAOF() error {
+	if s.aof == nil {
+		return ErrAOFNotEnabled
+	}
+
+	return s.CompactAOF(s.aof.path)
+}
+
+// setAOF pauses the appending to the enabled AOF if value is "off", and
+// resumes it if "on". The operations committed while paused are not appended:
+// on resume, the AOF is rewritten with the committed state, so that it is
+// complete again. If the rewrite fails, the AOF stays paused. Resuming an AOF
+// not paused does nothing.
+//
+// setAOF returns error if the AOF is not enabled.
+func (s *Store) setAOF(value string) error {
+	if s.aof == nil {
+		return ErrAOFNotEnabled
+	}
+
+	switch value {
+	case "off":
+		s.aofPaused = true
+		s.aof.mu.Lock()
+		defer s.aof.mu.Unlock()
+		return s.aof.sync()
+	case "on":
+		if !s.aofPaused {
+			return nil
+		}
+
+		// a failed rewrite stays paused, as the AOF misses operations.
+		if err := s.rewriteAOF(); err != nil {
+			return err
+		}
+
+		s.aofPaused = false
+		return nil
+	default:
+		return fmt.Errorf("%w: aof %s (on|off)", ErrInvalidArgument, value)
+	}
+}
+
+// Close releases the resources of the Store. Close syncs and closes the AOF,
+// if enabled.
+func (s *Store) Close() error {
+	if s.aof == nil {
+		return nil
+	}
+
+	err := s.aof.close()
+	s.aof = nil
+	return err
+}
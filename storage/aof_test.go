@@ -0,0 +1,563 @@
+package storage_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAOFReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "bye", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "discarded", want: "", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "open", want: "", wantErr: nil},
+	})
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	// restart
+	restarted := storage.NewStore()
+	if err := restarted.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer restarted.Close()
+
+	testStore(t, restarted, []testCase{
+		{cmd: "read", key: "a", val: "", want: "bye", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "note", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "d", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestAOFReplayTornRecord(t *testing.T) {
+	// a crash in the middle of the append of the record of c, before or
+	// after its value.
+	torns := map[string]string{
+		"partial":   `{"key":"c","val`,
+		"nonewline": `{"key":"c","value":"torn","write":true}`,
+	}
+
+	for name, torn := range torns {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "store.aof")
+
+			store := storage.NewStore()
+			if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+				t.Fatalf("\nGot Error '%s' want 'nil'", err)
+			}
+
+			testStore(t, store, []testCase{
+				{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+				{cmd: "write", key: "b", val: "bye", want: "", wantErr: nil},
+			})
+
+			if err := store.Close(); err != nil {
+				t.Fatalf("\nGot Error '%s' want 'nil'", err)
+			}
+
+			intact, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("\nGot Error '%s' want 'nil'", err)
+			}
+
+			if err := os.WriteFile(path, append(intact, torn...), 0644); err != nil {
+				t.Fatalf("\nGot Error '%s' want 'nil'", err)
+			}
+
+			logger := &recordingLogger{}
+			restarted := storage.NewStore(storage.WithLogger(logger))
+			if err := restarted.EnableAOF(path, storage.SyncAlways); err != nil {
+				t.Fatalf("\nGot Error '%s' want 'nil'", err)
+			}
+
+			if len(logger.calls) != 1 || !strings.HasPrefix(logger.calls[0], "error: aof "+path+": truncating torn record") {
+				t.Errorf("\nGot log calls '%v' want the torn record", logger.calls)
+			}
+
+			testStore(t, restarted, []testCase{
+				{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+				{cmd: "read", key: "b", val: "", want: "bye", wantErr: nil},
+				{cmd: "read", key: "c", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+				{cmd: "write", key: "c", val: "new", want: "", wantErr: nil},
+			})
+
+			if err := restarted.Close(); err != nil {
+				t.Fatalf("\nGot Error '%s' want 'nil'", err)
+			}
+
+			// the records appended after the truncation replay.
+			again := storage.NewStore()
+			if err := again.EnableAOF(path, storage.SyncAlways); err != nil {
+				t.Fatalf("\nGot Error '%s' want 'nil'", err)
+			}
+			defer again.Close()
+
+			testStore(t, again, []testCase{
+				{cmd: "read", key: "c", val: "", want: "new", wantErr: nil},
+			})
+
+			if n := countRecords(t, path); n != 3 {
+				t.Errorf("\nGot %d records in AOF want 3", n)
+			}
+		})
+	}
+}
+
+func TestAOFReplayCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "store.aof", `{"key":"a","value":"hi","write":true}`+"\noops\n"+`{"key":"b","value":"bye","write":true}`+"\n")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err == nil {
+		store.Close()
+		t.Fatalf("\nGot Error 'nil' want the corrupt record")
+	}
+
+	if n := countRecords(t, path); n != 3 {
+		t.Errorf("\nGot %d records in AOF want 3 untouched", n)
+	}
+}
+
+func TestAOFSyncAlways(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer store.Close()
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+	})
+
+	// without Close, the operation is already in the file
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if !strings.Contains(string(b), `"key":"a"`) {
+		t.Errorf("\nGot AOF '%s' want the write of 'a'", b)
+	}
+}
+
+func TestAOFSyncEverySecClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncEverySec); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "bye", want: "", wantErr: nil},
+	})
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if n := strings.Count(string(b), "\n"); n != 2 {
+		t.Errorf("\nGot %d records in AOF want 2", n)
+	}
+}
+
+func TestAOFSyncEverySecError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncEverySec); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	storage.FailAOFSync(store)
+
+	if _, err := store.Process("write", "a", "hi"); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("\nGot Error '%v' want '%v'", err, os.ErrClosed)
+	}
+
+	if err := store.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("\nGot Error '%v' want '%v'", err, os.ErrClosed)
+	}
+}
+
+func TestAOFEnableTwice(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncEverySec); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if err := store.EnableAOF(filepath.Join(dir, "other.aof"), storage.SyncAlways); !errors.Is(err, storage.ErrAOFEnabled) {
+		t.Errorf("\nGot Error '%v' want '%v'", err, storage.ErrAOFEnabled)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+	})
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	// the first AOF is kept, closed by Close.
+	if n := countRecords(t, path); n != 1 {
+		t.Errorf("\nGot %d records in AOF want 1", n)
+	}
+
+	// after Close, it can be enabled again.
+	if err := store.EnableAOF(filepath.Join(dir, "other.aof"), storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	store.Close()
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		want    storage.SyncPolicy
+		wantErr error
+	}{
+		{name: "always", want: storage.SyncAlways, wantErr: nil},
+		{name: "everysec", want: storage.SyncEverySec, wantErr: nil},
+		{name: "no", want: storage.SyncNo, wantErr: nil},
+		{name: "sometimes", want: 0, wantErr: storage.ErrInvalidSyncPolicy},
+	}
+
+	for _, tc := range cases {
+		p, err := storage.ParseSyncPolicy(tc.name)
+		if p != tc.want {
+			t.Errorf("\nGot policy '%s' want '%s'", p, tc.want)
+		}
+
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("\nGot Error '%s' want '%s'", err, tc.wantErr)
+		}
+	}
+}
+
+// countRecords returns the number of records in the AOF at path.
+func countRecords(t *testing.T, path string) int {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	return strings.Count(string(b), "\n")
+}
+
+func TestCompactAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		testStore(t, store, []testCase{
+			{cmd: "write", key: "a", val: fmt.Sprint(i), want: "", wantErr: nil},
+			{cmd: "write", key: "b", val: fmt.Sprint(i), want: "", wantErr: nil},
+			{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		})
+	}
+
+	if n := countRecords(t, path); n != 300 {
+		t.Fatalf("\nGot %d records before compaction want 300", n)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "bgrewriteaof", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	if n := countRecords(t, path); n != 1 {
+		t.Errorf("\nGot %d records after compaction want 1", n)
+	}
+
+	// appending continues on the compacted AOF
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+	})
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	restarted := storage.NewStore()
+	if err := restarted.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer restarted.Close()
+
+	testStore(t, restarted, []testCase{
+		{cmd: "read", key: "a", val: "", want: "99", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "hi", wantErr: nil},
+	})
+}
+
+func TestCompactAOFThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.aof")
+	link := filepath.Join(dir, "link.aof")
+	if err := os.Symlink("store.aof", link); err != nil {
+		t.Skip(err)
+	}
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		testStore(t, store, []testCase{
+			{cmd: "write", key: "a", val: fmt.Sprint(i), want: "", wantErr: nil},
+		})
+	}
+
+	// the live AOF is replaced, not the symlink
+	if err := store.CompactAOF(link); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+	})
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if n := countRecords(t, path); n != 2 {
+		t.Errorf("\nGot %d records want 2", n)
+	}
+
+	restarted := storage.NewStore()
+	if err := restarted.EnableAOF(link, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer restarted.Close()
+
+	testStore(t, restarted, []testCase{
+		{cmd: "read", key: "a", val: "", want: "2", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "hi", wantErr: nil},
+	})
+}
+
+func TestCompactAOFErrorKeepsAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer store.Close()
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+	})
+
+	// the temporary file can not be created
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Process("bgrewriteaof"); err == nil {
+		t.Fatalf("\nGot Error 'nil' want an error")
+	}
+
+	// appending continues on the enabled AOF
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+	})
+
+	if n := countRecords(t, path); n != 2 {
+		t.Errorf("\nGot %d records want 2", n)
+	}
+}
+
+func TestRewriteAOFNotEnabled(t *testing.T) {
+	cases := []testCase{
+		{cmd: "bgrewriteaof", key: "", val: "", want: "", wantErr: storage.ErrAOFNotEnabled},
+	}
+
+	test(t, cases)
+}
+
+func TestAOFPause(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "aof", key: "off", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+	})
+
+	// while paused, the operations are not in the file
+	if n := countRecords(t, path); n != 1 {
+		t.Errorf("\nGot %d records while paused want 1", n)
+	}
+
+	// resume rewrites the AOF with the committed state
+	testStore(t, store, []testCase{
+		{cmd: "aof", key: "on", val: "", want: "", wantErr: nil},
+	})
+
+	if n := countRecords(t, path); n != 2 {
+		t.Errorf("\nGot %d records after resume want 2", n)
+	}
+
+	// appending continues after resume
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "d", val: "hi", want: "", wantErr: nil},
+	})
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	restarted := storage.NewStore()
+	if err := restarted.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer restarted.Close()
+
+	testStore(t, restarted, []testCase{
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "hi", wantErr: nil},
+	})
+}
+
+func TestAOFResumeRewriteError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer store.Close()
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "aof", key: "off", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+	})
+
+	// the temporary file of the rewrite can not be created, nor removed
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path+".tmp", "blocker", "")
+
+	if _, err := store.Process("aof", "on"); err == nil {
+		t.Fatalf("\nGot Error 'nil' want an error")
+	}
+
+	// still paused
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+	})
+
+	if n := countRecords(t, path); n != 1 {
+		t.Errorf("\nGot %d records after the failed resume want 1", n)
+	}
+
+	if err := os.RemoveAll(path + ".tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "aof", key: "on", val: "", want: "", wantErr: nil},
+	})
+
+	if n := countRecords(t, path); n != 3 {
+		t.Errorf("\nGot %d records after resume want 3", n)
+	}
+}
+
+func TestAOFResumeNotPaused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer store.Close()
+
+	for i := 0; i < 3; i++ {
+		testStore(t, store, []testCase{
+			{cmd: "write", key: "a", val: fmt.Sprint(i), want: "", wantErr: nil},
+		})
+	}
+
+	// no rewrite: the history is kept
+	testStore(t, store, []testCase{
+		{cmd: "aof", key: "on", val: "", want: "", wantErr: nil},
+	})
+
+	if n := countRecords(t, path); n != 3 {
+		t.Errorf("\nGot %d records want 3", n)
+	}
+}
+
+func TestAOFPauseErrors(t *testing.T) {
+	cases := []testCase{
+		{cmd: "aof", key: "off", val: "", want: "", wantErr: storage.ErrAOFNotEnabled},
+		{cmd: "aof", key: "on", val: "", want: "", wantErr: storage.ErrAOFNotEnabled},
+	}
+
+	test(t, cases)
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(filepath.Join(t.TempDir(), "store.aof"), storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer store.Close()
+
+	testStore(t, store, []testCase{
+		{cmd: "aof", key: "maybe", val: "", want: "", wantErr: storage.ErrInvalidArgument},
+	})
+}
@@ -0,0 +1,55 @@
+package storage
+
+// TxView is the view of a Store inside an Atomic block. It exposes only the
+// operations on keys: the transaction is managed by Atomic.
+type TxView struct {
+	store *Store
+}
+
+// Read returns the current value of the key key, as seen by the transaction.
+//
+// Read returns error if the key does not exist.
+func (v *TxView) Read(key string) (string, error) {
+	return v.store.read(key)
+}
+
+// Write writes the value and the key in the transaction.
+func (v *TxView) Write(key, value string) error {
+	return v.store.write(key, value)
+}
+
+// Remove removes the key in the transaction.
+//
+// Remove returns error if the key does not exist.
+func (v *TxView) Remove(key string) error {
+	return v.store.remove(key)
+}
+
+// Atomic runs fn inside a new transaction. If fn returns nil, the transaction
+// is committed. Otherwise, or if fn panics, the transaction is discarded.
+//
+// With autocommit off, the implicit transaction is begun first at the root,
+// so the transaction of fn is nested in it and a discard reverts it.
+//
+// Atomic returns the error of fn, or the error of the commit.
+func (s *Store) Atomic(fn func(tx *TxView) error) error {
+	if s.currTx.isRoot() && s.noAutoCommit {
+		s.begin()
+	}
+
+	s.begin()
+
+	committed := false
+	defer func() {
+		if !committed {
+			s.discard()
+		}
+	}()
+
+	if err := fn(&TxView{store: s}); err != nil {
+		return err
+	}
+
+	committed = true
+	return s.commit()
+}
@@ -0,0 +1,99 @@
+package storage_test
+
+import (
+	"errors"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+func TestAtomicCommit(t *testing.T) {
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+	})
+
+	err := store.Atomic(func(tx *storage.TxView) error {
+		v, err := tx.Read("a")
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Write("b", v+" again"); err != nil {
+			return err
+		}
+
+		return tx.Remove("a")
+	})
+
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b", val: "", want: "hi again", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	})
+}
+
+func TestAtomicRollback(t *testing.T) {
+	errAbort := errors.New("abort")
+
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+	})
+
+	err := store.Atomic(func(tx *storage.TxView) error {
+		if err := tx.Write("a", "bye"); err != nil {
+			return err
+		}
+
+		if err := tx.Remove("missing"); err != nil {
+			return err
+		}
+
+		return errAbort
+	})
+
+	if !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("\nGot Error '%s' want '%s'", err, storage.ErrKeyNotFound)
+	}
+
+	err = store.Atomic(func(tx *storage.TxView) error {
+		tx.Write("b", "bye")
+		return errAbort
+	})
+
+	if !errors.Is(err, errAbort) {
+		t.Errorf("\nGot Error '%s' want '%s'", err, errAbort)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	})
+}
+
+func TestAtomicPanic(t *testing.T) {
+	store := storage.NewStore()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("\nGot no panic want the panic of the block")
+			}
+		}()
+
+		store.Atomic(func(tx *storage.TxView) error {
+			tx.Write("a", "hi")
+			panic("block")
+		})
+	}()
+
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	})
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var (
+	ErrAuditNotEnabled error = errors.New("Audit log not enabled")
+)
+
+// auditEntry is an operation applied to the kvStore, numbered in order.
+type auditEntry struct {
+	seq int
+	op  operation
+
+	// reset marks the replacement of the whole committed state, by a restore.
+	// The writes of the restored keys follow it.
+	reset bool
+}
+
+// logRecord is the representation of an audit log entry in the files of the
+// exportlog command. Like the AOF, the file contains one JSON encoded record
+// per line, in order, with the sequence number of the entry.
+type logRecord struct {
+	Seq   int  `json:"seq"`
+	Reset bool `json:"reset,omitempty"`
+	aofRecord
+}
+
+// auditLog records the operations applied to the kvStore, so past committed
+// states can be reconstructed.
+type auditLog struct {
+	entries []auditEntry
+
+	// seq is the sequence number of the last entry. 0 if there is none.
+	seq int
+}
+
+// WithAuditLog makes the Store record every operation applied to the kvStore,
+// by commits or directly at the root, with a sequence number. The log is kept
+// in memory and grows without limit.
+func WithAuditLog() Option {
+	return func(s *Store) {
+		s.audit = &auditLog{}
+	}
+}
+
+// record appends the applied operation op to the audit log, if enabled.
+func (s *Store) record(op operation) {
+	if s.audit == nil {
+		return
+	}
+
+	s.audit.seq++
+	s.audit.entries = append(s.audit.entries, auditEntry{seq: s.audit.seq, op: op})
+}
+
+// recordRestore appends to the audit log, if enabled, the replacement of the
+// committed state by a restore: a reset, and then a write of each restored
+// key, in order.
+func (s *Store) recordRestore() {
+	if s.audit == nil {
+		return
+	}
+
+	s.audit.seq++
+	s.audit.entries = append(s.audit.entries, auditEntry{seq: s.audit.seq, reset: true})
+
+	keys := make([]string, 0, len(s.kv))
+	for k := range s.kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		e := s.kv[k]
+		s.record(operation{key: k, value: e.value, isWrite: true, expireAt: e.expireAt})
+	}
+}
+
+// lastSeq returns the sequence number of the last operation of the audit log.
+//
+// lastSeq returns error if the audit log is not enabled.
+func (s *Store) lastSeq() (int, error) {
+	if s.audit == nil {
+		return 0, ErrAuditNotEnabled
+	}
+
+	return s.audit.seq, nil
+}
+
+// readAt returns the committed value of the key key immediately after the
+// operation with sequence number seq was applied, by replaying the audit log
+// up to it. The expiration of the keys is not taken into account.
+//
+// readAt returns error if the audit log is not enabled, if seq is not a
+// sequence number of the log, or if the key did not exist at seq.
+func (s *Store) readAt(key string, seq int) (string, error) {
+	key = s.normalize(key)
+	if s.audit == nil {
+		return "", ErrAuditNotEnabled
+	}
+
+	if seq < 0 || seq > s.audit.seq {
+		return "", fmt.Errorf("%w: sequence number %d (0-%d)", ErrInvalidArgument, seq, s.audit.seq)
+	}
+
+	value, found := "", false
+	for _, e := range s.audit.entries {
+		if e.seq > seq {
+			break
+		}
+
+		switch {
+		case e.reset:
+			value, found = "", false
+		case e.op.key != key || e.op.isNote:
+			continue
+		default:
+			value, found = e.op.value, e.op.isWrite
+		}
+	}
+
+	if !found {
+		return "", fmt.Errorf("%w: %s at %d", ErrKeyNotFound, key, seq)
+	}
+
+	return value, nil
+}
+
+// exportLog writes the audit log to the file at path, replacing it. It returns
+// the number of entries written.
+//
+// exportLog returns error if the audit log is not enabled.
+func (s *Store) exportLog(path string) (int, error) {
+	if s.audit == nil {
+		return 0, ErrAuditNotEnabled
+	}
+
+	err := createFile(path, func(f io.Writer) error {
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		for _, e := range s.audit.entries {
+			r := logRecord{Seq: e.seq, Reset: e.reset}
+			if !e.reset {
+				r.aofRecord = newAOFRecord(e.op)
+			}
+
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+
+		return w.Flush()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(s.audit.entries), nil
+}
+
+// importLog replays the audit log in the file at path, as written by
+// exportLog, on the committed state: the operations are applied in order,
+// and a reset replaces the committed state with an empty one. Open
+// transactions are kept. It returns the number of entries replayed.
+//
+// importLog returns error if the sequence numbers of the file are not
+// increasing. The entries before the invalid one are already replayed.
+func (s *Store) importLog(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, reset, err := s.replayLog(f, path)
+
+	// the AOF does not know about the resets: it is rewritten even if the
+	// import failed after one.
+	if reset && s.aof != nil {
+		if rewriteErr := s.rewriteAOF(); err == nil {
+			err = rewriteErr
+		}
+	}
+
+	return n, err
+}
+
+// replayLog replays the audit log read from src, from the file at path, on the
+// committed state. It returns the number of entries replayed, and whether any
+// of them was a reset, also on error.
+func (s *Store) replayLog(src io.Reader, path string) (int, bool, error) {
+	n, last, reset := 0, 0, false
+	dec := json.NewDecoder(src)
+	for {
+		var r logRecord
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			return n, reset, nil
+		}
+
+		if err != nil {
+			return n, reset, fmt.Errorf("log %s: %w", path, err)
+		}
+
+		if r.Seq <= last {
+			return n, reset, fmt.Errorf("%w: sequence number %d after %d", ErrInvalidArgument, r.Seq, last)
+		}
+		last = r.Seq
+
+		if r.Reset {
+			s.kv = make(kvStore)
+			s.notes = make(map[string]string)
+			s.rebuildBloom()
+			s.rebuildLRU()
+			s.recordRestore()
+			reset = true
+		} else if err := s.apply(r.operation()); err != nil {
+			return n, reset, err
+		}
+
+		n++
+	}
+}
@@ -0,0 +1,208 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// lastSeq returns the sequence number of the last operation of the audit log
+// of the Store store.
+func lastSeq(t *testing.T, store *storage.Store) string {
+	t.Helper()
+	v, err := store.Process("lastseq")
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if _, err := strconv.Atoi(v); err != nil {
+		t.Fatalf("\nGot sequence number '%s' want an integer", v)
+	}
+
+	return v
+}
+
+func TestReadAt(t *testing.T) {
+	store := storage.NewStore(storage.WithAuditLog())
+	start := lastSeq(t, store)
+
+	testStore(t, store, []testCase{{cmd: "write", key: "a", val: "1"}})
+	first := lastSeq(t, store)
+
+	testStore(t, store, []testCase{
+		{cmd: "begin"},
+		{cmd: "write", key: "a", val: "2"},
+		{cmd: "write", key: "b", val: "1"},
+	})
+	// not committed yet
+	pending := lastSeq(t, store)
+	testStore(t, store, []testCase{{cmd: "commit"}})
+	second := lastSeq(t, store)
+
+	testStore(t, store, []testCase{
+		{cmd: "annotate", key: "a", val: "note"},
+		{cmd: "remove", key: "a"},
+	})
+	removed := lastSeq(t, store)
+
+	testStore(t, store, []testCase{{cmd: "write", key: "a", val: "3"}})
+	third := lastSeq(t, store)
+
+	testStore(t, store, []testCase{
+		{cmd: "readat", key: "a", val: start, want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "readat", key: "a", val: first, want: "1", wantErr: nil},
+		{cmd: "readat", key: "a", val: pending, want: "1", wantErr: nil},
+		{cmd: "readat", key: "b", val: pending, want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "readat", key: "a", val: second, want: "2", wantErr: nil},
+		{cmd: "readat", key: "b", val: second, want: "1", wantErr: nil},
+		{cmd: "readat", key: "a", val: removed, want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "readat", key: "a", val: third, want: "3", wantErr: nil},
+		{cmd: "readat", key: "a", val: "-1", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "readat", key: "a", val: "x", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "readat", key: "a", val: "1000", want: "", wantErr: storage.ErrInvalidArgument},
+	})
+}
+
+func TestReadAtRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.snap")
+
+	store := storage.NewStore(storage.WithAuditLog())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "saved"},
+		{cmd: "snapshot", key: path},
+		{cmd: "write", key: "a", val: "lost"},
+		{cmd: "write", key: "b", val: "lost"},
+	})
+	before := lastSeq(t, store)
+
+	testStore(t, store, []testCase{{cmd: "restore", key: path}})
+	restored := lastSeq(t, store)
+
+	testStore(t, store, []testCase{
+		{cmd: "readat", key: "a", val: before, want: "lost", wantErr: nil},
+		{cmd: "readat", key: "b", val: before, want: "lost", wantErr: nil},
+		{cmd: "readat", key: "a", val: restored, want: "saved", wantErr: nil},
+		{cmd: "readat", key: "b", val: restored, want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestReadAtNotEnabled(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "readat", key: "a", val: "1", want: "", wantErr: storage.ErrAuditNotEnabled},
+		{cmd: "lastseq", key: "", val: "", want: "", wantErr: storage.ErrAuditNotEnabled},
+	}
+
+	test(t, cases)
+}
+
+func TestExportLogReplay(t *testing.T) {
+	dir := t.TempDir()
+	snap := filepath.Join(dir, "store.snap")
+	log := filepath.Join(dir, "store.log")
+
+	store := storage.NewStore(storage.WithAuditLog())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "1"},
+		{cmd: "write", key: "gone", val: "1"},
+		{cmd: "snapshot", key: snap},
+		{cmd: "write", key: "lost", val: "1"},
+		{cmd: "restore", key: snap},
+		{cmd: "begin"},
+		{cmd: "write", key: "a", val: "2"},
+		{cmd: "annotate", key: "a", val: "note"},
+		{cmd: "setex", args: []string{"b", "100", "expiring"}},
+		{cmd: "remove", key: "gone"},
+		{cmd: "commit"},
+		{cmd: "begin"},
+		{cmd: "write", key: "discarded", val: "1"},
+		{cmd: "discard"},
+	})
+	n := lastSeq(t, store)
+
+	testStore(t, store, []testCase{
+		{cmd: "exportlog", key: log, want: n, wantErr: nil},
+	})
+
+	replayed := storage.NewStore(storage.WithAuditLog())
+	testStore(t, replayed, []testCase{
+		{cmd: "importlog", key: log, want: n, wantErr: nil},
+		{cmd: "read", key: "a", want: "2", wantErr: nil},
+		{cmd: "note", key: "a", want: "note", wantErr: nil},
+		{cmd: "read", key: "b", want: "expiring", wantErr: nil},
+		{cmd: "read", key: "gone", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "lost", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "discarded", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+
+	want, _ := store.Process("storehash")
+	got, _ := replayed.Process("storehash")
+	if got != want {
+		t.Errorf("\nGot store hash '%s' want '%s'", got, want)
+	}
+
+	// the replayed log is the same history
+	testStore(t, replayed, []testCase{
+		{cmd: "lastseq", want: n, wantErr: nil},
+		{cmd: "readat", key: "lost", val: "3", want: "1", wantErr: nil},
+		{cmd: "readat", key: "lost", val: "4", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestImportLogErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []testCase{
+		{cmd: "exportlog", key: filepath.Join(dir, "f.log"), want: "", wantErr: storage.ErrAuditNotEnabled},
+		{cmd: "importlog", key: writeFile(t, dir, "order.log", `{"seq":2,"key":"a","value":"1","write":true}`+"\n"+`{"seq":1,"key":"b","value":"1","write":true}`+"\n"), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "importlog", key: filepath.Join(dir, "missing.log"), want: "", wantErr: fs.ErrNotExist},
+		// the entries before the invalid one are replayed
+		{cmd: "read", key: "a", want: "1", wantErr: nil},
+		{cmd: "read", key: "b", want: "", wantErr: storage.ErrKeyNotFound},
+	}
+
+	test(t, cases)
+
+	if _, err := storage.NewStore().Process("importlog", writeFile(t, dir, "invalid.log", "{")); err == nil {
+		t.Errorf("\nGot Error 'nil' want the invalid log")
+	}
+}
+
+func TestImportLogResetRewritesAOF(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.aof")
+
+	store := storage.NewStore()
+	if err := store.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	log := writeFile(t, dir, "reset.log", `{"seq":1,"reset":true}`+"\n"+
+		`{"seq":2,"key":"b","value":"1","write":true}`+"\n"+
+		`{"seq":2,"key":"c","value":"1","write":true}`+"\n")
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "importlog", key: log, want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "read", key: "a", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b", want: "1", wantErr: nil},
+	})
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	// the AOF replays to the state after the reset
+	restarted := storage.NewStore()
+	if err := restarted.EnableAOF(path, storage.SyncAlways); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	defer restarted.Close()
+
+	testStore(t, restarted, []testCase{
+		{cmd: "read", key: "a", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b", want: "1", wantErr: nil},
+	})
+}
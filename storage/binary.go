@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// writeHex writes to the key the bytes encoded in hex by value, so the text
+// commands can store binary values. Both cases of the hex digits are
+// accepted.
+//
+// writeHex returns ErrInvalidArgument if value is not valid hex.
+func (s *Store) writeHex(key, value string) error {
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("%w: %s (hex required: %v)", ErrInvalidArgument, value, err)
+	}
+
+	return s.write(key, string(b))
+}
+
+// readHex returns the value of the key encoded in lowercase hex.
+//
+// readHex returns error if the key does not exist.
+func (s *Store) readHex(key string) (string, error) {
+	v, err := s.read(key)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString([]byte(v)), nil
+}
+
+// writeB64 writes to the key the bytes encoded in standard, padded base64 by
+// value, so the text commands can store binary values.
+//
+// writeB64 returns ErrInvalidArgument if value is not valid base64.
+func (s *Store) writeB64(key, value string) error {
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("%w: %s (base64 required: %v)", ErrInvalidArgument, value, err)
+	}
+
+	return s.write(key, string(b))
+}
+
+// readB64 returns the value of the key encoded in standard, padded base64.
+//
+// readB64 returns error if the key does not exist.
+func (s *Store) readB64(key string) (string, error) {
+	v, err := s.read(key)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(v)), nil
+}
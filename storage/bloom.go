@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"hash/fnv"
+)
+
+// bloomBitsPerKey and bloomHashes size the Bloom filter for a false positive
+// rate of about 1%.
+const (
+	bloomBitsPerKey = 10
+	bloomHashes     = 7
+)
+
+// bloomFilter is a Bloom filter over keys. A key not in the filter was never
+// added; a key in the filter may have been. Keys can not be removed.
+type bloomFilter struct {
+	bits []uint64
+}
+
+// newBloomFilter returns an empty Bloom filter sized for n keys.
+func newBloomFilter(n int) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+
+	return &bloomFilter{bits: make([]uint64, (n*bloomBitsPerKey+63)/64)}
+}
+
+// positions calls fn with the bloomHashes bit positions of the key, derived
+// by double hashing of its FNV-1a hash.
+func (b *bloomFilter) positions(key string, fn func(i uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		fn((h1 + i*h2) % m)
+	}
+}
+
+// add adds the key to the filter.
+func (b *bloomFilter) add(key string) {
+	b.positions(key, func(i uint64) {
+		b.bits[i/64] |= 1 << (i % 64)
+	})
+}
+
+// mayContain returns false if the key was never added to the filter.
+func (b *bloomFilter) mayContain(key string) bool {
+	found := true
+	b.positions(key, func(i uint64) {
+		if b.bits[i/64]&(1<<(i%64)) == 0 {
+			found = false
+		}
+	})
+
+	return found
+}
+
+// WithBloomFilter makes the Store keep a Bloom filter, sized for n keys, of
+// the keys written, committed or in a transaction. A read of a key never
+// written is then answered without scanning the transactions, which speeds
+// up the misses of large transactions.
+//
+// The filter only grows: removed keys are still scanned for. It is rebuilt
+// when the committed state is replaced, by restore or restorecheckpoint.
+func WithBloomFilter(n int) Option {
+	return func(s *Store) {
+		s.bloom = newBloomFilter(n)
+	}
+}
+
+// addBloom adds the key of the write op to the Bloom filter, if enabled.
+func (s *Store) addBloom(op operation) {
+	if s.bloom == nil || !op.isWrite || op.isNote {
+		return
+	}
+
+	s.bloom.add(op.key)
+}
+
+// rebuildBloom replaces the Bloom filter, if enabled, by one with the keys of
+// the committed state and of the open transactions.
+func (s *Store) rebuildBloom() {
+	if s.bloom == nil {
+		return
+	}
+
+	n := len(s.kv)
+	if bits := len(s.bloom.bits) * 64 / bloomBitsPerKey; bits > n {
+		n = bits
+	}
+
+	s.bloom = newBloomFilter(n)
+	for k := range s.kv {
+		s.bloom.add(k)
+	}
+
+	for _, t := range s.levels() {
+		for _, op := range t.operations {
+			s.addBloom(op)
+		}
+	}
+}
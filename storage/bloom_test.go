@@ -0,0 +1,98 @@
+package storage_test
+
+import (
+	"fmt"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// TestBloomFilterNoFalseNegatives runs the same random churn on a Store with
+// and without the Bloom filter, sized too small on purpose, and checks that
+// every read gives the same result.
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	plain := storage.NewStore()
+	bloom := storage.NewStore(storage.WithBloomFilter(8))
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("k%d", rnd.Intn(200))
+
+		var cmd string
+		var args []string
+		switch rnd.Intn(10) {
+		case 0:
+			cmd = "begin"
+		case 1:
+			cmd = "commit"
+		case 2:
+			cmd = "discard"
+		case 3, 4:
+			cmd, args = "remove", []string{key}
+		case 5:
+			cmd, args = "read", []string{key}
+		default:
+			cmd, args = "write", []string{key, fmt.Sprint(i)}
+		}
+
+		wantV, wantErr := plain.Process(cmd, args...)
+		gotV, gotErr := bloom.Process(cmd, args...)
+		if gotV != wantV || fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+			t.Fatalf("\nGot '%s' '%v' want '%s' '%v' (step %d: %s %v)", gotV, gotErr, wantV, wantErr, i, cmd, args)
+		}
+	}
+
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("k%d", i)
+		wantV, wantErr := plain.Process("read", key)
+		gotV, gotErr := bloom.Process("read", key)
+		if gotV != wantV || fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+			t.Errorf("\nGot '%s' '%v' want '%s' '%v' (read %s)", gotV, gotErr, wantV, wantErr, key)
+		}
+	}
+}
+
+func TestBloomFilterRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.snapshot")
+
+	test(t, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "snapshot", key: path, val: "", want: "", wantErr: nil},
+	})
+
+	store := storage.NewStore(storage.WithBloomFilter(100))
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "restore", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "checkpoint", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "restore", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "restorecheckpoint", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "hi", wantErr: nil},
+	})
+}
+
+// benchmarkReadMiss reads missing keys with a transaction of 10000
+// operations open.
+func benchmarkReadMiss(b *testing.B, opts ...storage.Option) {
+	store := storage.NewStore(opts...)
+	store.Process("begin")
+	for i := 0; i < 10000; i++ {
+		store.Process("write", fmt.Sprintf("k%d", i), "v")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.Process("read", "missing")
+	}
+}
+
+func BenchmarkReadMiss(b *testing.B) {
+	benchmarkReadMiss(b)
+}
+
+func BenchmarkReadMissBloom(b *testing.B) {
+	benchmarkReadMiss(b, storage.WithBloomFilter(10000))
+}
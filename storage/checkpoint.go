@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrCheckpointNotFound error = errors.New("Checkpoint not found")
+
+// checkpoint is a copy of the committed state of a Store.
+type checkpoint struct {
+	kv    kvStore
+	notes map[string]string
+}
+
+// copy returns a copy of the checkpoint c, independent of further changes to
+// c.
+func (c checkpoint) copy() checkpoint {
+	cp := checkpoint{kv: make(kvStore, len(c.kv)), notes: make(map[string]string, len(c.notes))}
+	for k, e := range c.kv {
+		cp.kv[k] = e
+	}
+
+	for k, n := range c.notes {
+		cp.notes[k] = n
+	}
+
+	return cp
+}
+
+// checkpoint saves a copy of the committed state under the name name,
+// replacing any checkpoint with the same name. Open transactions are not part
+// of the checkpoint.
+func (s *Store) checkpoint(name string) {
+	if s.checkpoints == nil {
+		s.checkpoints = make(map[string]checkpoint)
+	}
+
+	s.checkpoints[name] = checkpoint{kv: s.kv, notes: s.notes}.copy()
+}
+
+// restoreCheckpoint replaces the committed state with the checkpoint name.
+// All open transactions are discarded. The checkpoint is kept, and can be
+// restored again. If the AOF is enabled, it is rewritten with the restored
+// state.
+//
+// restoreCheckpoint returns error if there is no checkpoint name.
+func (s *Store) restoreCheckpoint(name string) error {
+	c, ok := s.checkpoints[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCheckpointNotFound, name)
+	}
+
+	// copy again, so the checkpoint is not modified by the restored state.
+	restored := c.copy()
+	s.kv = restored.kv
+	s.notes = restored.notes
+	s.currTx = &tx{}
+	s.rebuildBloom()
+	s.rebuildLRU()
+	s.recordRestore()
+
+	if s.aof == nil {
+		return nil
+	}
+
+	return s.rewriteAOF()
+}
@@ -0,0 +1,42 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	cases := []testCase{
+		{cmd: "restorecheckpoint", key: "one", val: "", want: "", wantErr: storage.ErrCheckpointNotFound},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "open", val: "hi", want: "", wantErr: nil},
+		{cmd: "checkpoint", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "bye", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "bye", want: "", wantErr: nil},
+		{cmd: "checkpoint", key: "two", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "restorecheckpoint", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "note", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "open", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+
+		// mutations after a restore do not change the checkpoint
+		{cmd: "write", key: "a", val: "changed", want: "", wantErr: nil},
+		{cmd: "restorecheckpoint", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+
+		// checkpoints are independent
+		{cmd: "restorecheckpoint", key: "two", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "bye", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "bye", wantErr: nil},
+		{cmd: "read", key: "open", val: "", want: "hi", wantErr: nil},
+	}
+
+	test(t, cases)
+}
@@ -0,0 +1,98 @@
+package storage
+
+// mutatingCommands classifies every command of the Store: true if it is
+// mutating, false if it is read-only.
+var mutatingCommands = map[string]bool{
+	Write:    true,
+	Read:     false,
+	Remove:   true,
+	Begin:    true,
+	Commit:   true,
+	Discard:  true,
+	TxKeys:   false,
+	SetEx:    true,
+	GetDel:   true,
+	Annotate: true,
+	Note:     false,
+
+	SnapshotFile: false,
+	RestoreFile:  true,
+	RewriteAOF:   true,
+	AOF:          true,
+
+	CommitCost: false,
+	Check:      false,
+	Metrics:    false,
+	KeyHistory: false,
+	ResetTx:    true,
+
+	Checkpoint:        true,
+	RestoreCheckpoint: true,
+
+	Tree:      false,
+	MergeFile: true,
+	List:      false,
+	Dirty:     false,
+	Compact:   true,
+	ReadAll:   false,
+	Eq:        false,
+	Assert:    false,
+	Grep:      false,
+
+	RenamePrefix: true,
+	CopyPrefix:   true,
+	Flatten:      true,
+	MGetPrefix:   false,
+	CommitTiming: false,
+	Verify:       false,
+	StoreHash:    false,
+
+	Savepoint:  true,
+	RollbackTo: true,
+	Savepoints: false,
+
+	TxSizes:    false,
+	AutoCommit: true,
+	Stats:      false,
+
+	Truncate: true,
+	Replace:  true,
+	Reverse:  true,
+	Upper:    true,
+	Lower:    true,
+	Inspect:  false,
+
+	WriteEnv:     true,
+	ExportPrefix: false,
+	CountValues:  false,
+	LenHist:      false,
+	Top:          false,
+	ImportJSON:   true,
+	ExportJSON:   false,
+	DiffFiles:    false,
+	Patch:        true,
+	Flush:        true,
+	Explain:      false,
+	ReadAt:       false,
+	LastSeq:      false,
+	SortByValue:  false,
+	ExportLog:    false,
+	ImportLog:    true,
+
+	DeleteMatching: true,
+	WriteHex:       true,
+	ReadHex:        false,
+	WriteB64:       true,
+	ReadB64:        false,
+	Info:           false,
+}
+
+// IsMutating reports whether the command command changes the Store: its data,
+// transactions, checkpoints, persistence or settings. The read-only commands
+// leave the Store as it was, even if they write files, like snapshot.
+//
+// ok is false if the command is unknown.
+func IsMutating(command string) (mutating, ok bool) {
+	mutating, ok = mutatingCommands[command]
+	return mutating, ok
+}
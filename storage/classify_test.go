@@ -0,0 +1,28 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+func TestIsMutating(t *testing.T) {
+	cases := []struct {
+		command      string
+		wantMutating bool
+		wantOk       bool
+	}{
+		{command: storage.Write, wantMutating: true, wantOk: true},
+		{command: storage.Read, wantMutating: false, wantOk: true},
+		{command: storage.Begin, wantMutating: true, wantOk: true},
+		{command: storage.SnapshotFile, wantMutating: false, wantOk: true},
+		{command: storage.RestoreFile, wantMutating: true, wantOk: true},
+		{command: "unknown", wantMutating: false, wantOk: false},
+	}
+
+	for _, tc := range cases {
+		mutating, ok := storage.IsMutating(tc.command)
+		if mutating != tc.wantMutating || ok != tc.wantOk {
+			t.Errorf("\n%s: Got %t, %t want %t, %t", tc.command, mutating, ok, tc.wantMutating, tc.wantOk)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package storage_test
+
+import (
+	"fmt"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+// TestReadYourWrites checks that every mutation is visible to the reads that
+// follow it: in the same transaction, in a nested one and, once committed, in
+// the parent. Each mutation runs at the root and at several nesting levels,
+// with and without the eager compaction.
+func TestReadYourWrites(t *testing.T) {
+	mutations := []struct {
+		name   string
+		setup  []testCase
+		mutate []testCase
+		check  []testCase
+	}{
+		{
+			name:   "write",
+			mutate: []testCase{{cmd: "write", key: "a", val: "new"}},
+			check:  []testCase{{cmd: "read", key: "a", want: "new"}},
+		},
+		{
+			name:   "overwrite",
+			setup:  []testCase{{cmd: "write", key: "a", val: "old"}},
+			mutate: []testCase{{cmd: "write", key: "a", val: "new"}},
+			check:  []testCase{{cmd: "read", key: "a", want: "new"}},
+		},
+		{
+			name:   "setex",
+			setup:  []testCase{{cmd: "write", key: "a", val: "old"}},
+			mutate: []testCase{{cmd: "setex", args: []string{"a", "10", "new"}}},
+			check:  []testCase{{cmd: "read", key: "a", want: "new"}},
+		},
+		{
+			name:   "remove",
+			setup:  []testCase{{cmd: "write", key: "a", val: "old"}},
+			mutate: []testCase{{cmd: "remove", key: "a"}},
+			check: []testCase{
+				{cmd: "read", key: "a", wantErr: storage.ErrKeyNotFound},
+				{cmd: "list", args: []string{}, want: ""},
+			},
+		},
+		{
+			name:   "getdel",
+			setup:  []testCase{{cmd: "write", key: "a", val: "old"}},
+			mutate: []testCase{{cmd: "getdel", key: "a", want: "old"}},
+			check:  []testCase{{cmd: "read", key: "a", wantErr: storage.ErrKeyNotFound}},
+		},
+		{
+			name:   "remove and write",
+			setup:  []testCase{{cmd: "write", key: "a", val: "old"}},
+			mutate: []testCase{{cmd: "remove", key: "a"}, {cmd: "write", key: "a", val: "new"}},
+			check: []testCase{
+				{cmd: "read", key: "a", want: "new"},
+				{cmd: "readall", args: []string{}, want: `{"a":"new"}`},
+			},
+		},
+		{
+			name:   "annotate",
+			setup:  []testCase{{cmd: "write", key: "a", val: "old"}},
+			mutate: []testCase{{cmd: "annotate", key: "a", val: "note"}},
+			check: []testCase{
+				{cmd: "note", key: "a", want: "note"},
+				{cmd: "read", key: "a", want: "old"},
+			},
+		},
+		{
+			name: "write keeps note",
+			setup: []testCase{
+				{cmd: "write", key: "a", val: "old"},
+				{cmd: "annotate", key: "a", val: "note"},
+			},
+			mutate: []testCase{{cmd: "write", key: "a", val: "new"}},
+			check: []testCase{
+				{cmd: "read", key: "a", want: "new"},
+				{cmd: "note", key: "a", want: "note"},
+			},
+		},
+		{
+			name: "remove clears note",
+			setup: []testCase{
+				{cmd: "write", key: "a", val: "old"},
+				{cmd: "annotate", key: "a", val: "note"},
+			},
+			mutate: []testCase{{cmd: "remove", key: "a"}, {cmd: "write", key: "a", val: "new"}},
+			check: []testCase{
+				{cmd: "read", key: "a", want: "new"},
+				{cmd: "note", key: "a", want: ""},
+			},
+		},
+		{
+			name:  "renameprefix",
+			setup: []testCase{{cmd: "write", key: "a1", val: "old"}},
+			mutate: []testCase{
+				{cmd: "write", key: "a2", val: "new"},
+				{cmd: "renameprefix", key: "a", val: "b", want: "2"},
+			},
+			check: []testCase{
+				{cmd: "read", key: "a1", wantErr: storage.ErrKeyNotFound},
+				{cmd: "read", key: "b1", want: "old"},
+				{cmd: "read", key: "b2", want: "new"},
+			},
+		},
+		{
+			name:  "many writes",
+			setup: []testCase{{cmd: "write", key: "a", val: "old"}},
+			mutate: []testCase{
+				{cmd: "write", key: "a", val: "1"},
+				{cmd: "write", key: "b", val: "1"},
+				{cmd: "remove", key: "a"},
+				{cmd: "write", key: "c", val: "1"},
+				{cmd: "write", key: "a", val: "2"},
+				{cmd: "remove", key: "b"},
+			},
+			check: []testCase{
+				{cmd: "read", key: "a", want: "2"},
+				{cmd: "read", key: "b", wantErr: storage.ErrKeyNotFound},
+				{cmd: "read", key: "c", want: "1"},
+			},
+		},
+	}
+
+	options := map[string][]storage.Option{
+		"default":   nil,
+		"compacted": {storage.WithFlushThreshold(1)},
+	}
+
+	for optName, opts := range options {
+		for _, m := range mutations {
+			for depth := 0; depth <= 2; depth++ {
+				name := fmt.Sprintf("%s/%s/depth %d", optName, m.name, depth)
+				t.Run(name, func(t *testing.T) {
+					store := storage.NewStore(opts...)
+					testStore(t, store, m.setup)
+					for i := 0; i < depth; i++ {
+						testStore(t, store, []testCase{{cmd: "begin"}})
+					}
+
+					// same transaction
+					testStore(t, store, m.mutate)
+					testStore(t, store, m.check)
+
+					// nested transaction
+					testStore(t, store, []testCase{{cmd: "begin"}})
+					testStore(t, store, m.check)
+					testStore(t, store, []testCase{{cmd: "commit"}})
+					testStore(t, store, m.check)
+
+					// committed to the parents
+					for i := 0; i < depth; i++ {
+						testStore(t, store, []testCase{{cmd: "commit"}})
+						testStore(t, store, m.check)
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestCommitLeavesNoRootOperations checks that no sequence of commits leaves
+// operations in the root, unapplied to the kvStore: after every commit the
+// integrity check passes and, back at the root, the committed data is
+// visible.
+func TestCommitLeavesNoRootOperations(t *testing.T) {
+	sequences := []struct {
+		name  string
+		opts  []storage.Option
+		steps []testCase
+		check []testCase
+	}{
+		{
+			name: "middle transaction",
+			steps: []testCase{
+				{cmd: "begin"},
+				{cmd: "write", key: "a", val: "1"},
+				{cmd: "begin"},
+				{cmd: "write", key: "b", val: "1"},
+				{cmd: "begin"},
+				{cmd: "write", key: "c", val: "1"},
+				{cmd: "commit"},
+				{cmd: "commit"},
+				{cmd: "write", key: "d", val: "1"},
+				{cmd: "commit"},
+			},
+			check: []testCase{
+				{cmd: "readall", args: []string{}, want: `{"a":"1","b":"1","c":"1","d":"1"}`},
+			},
+		},
+		{
+			name: "empty transactions",
+			steps: []testCase{
+				{cmd: "begin"},
+				{cmd: "write", key: "a", val: "1"},
+				{cmd: "begin"},
+				{cmd: "begin"},
+				{cmd: "commit"},
+				{cmd: "commit"},
+				{cmd: "commit"},
+				{cmd: "begin"},
+				{cmd: "commit"},
+			},
+			check: []testCase{{cmd: "read", key: "a", want: "1"}},
+		},
+		{
+			name: "discarded inner transaction",
+			steps: []testCase{
+				{cmd: "write", key: "a", val: "1"},
+				{cmd: "begin"},
+				{cmd: "remove", key: "a"},
+				{cmd: "begin"},
+				{cmd: "write", key: "a", val: "2"},
+				{cmd: "discard"},
+				{cmd: "commit"},
+			},
+			check: []testCase{{cmd: "read", key: "a", wantErr: storage.ErrKeyNotFound}},
+		},
+		{
+			name: "savepoint",
+			steps: []testCase{
+				{cmd: "begin"},
+				{cmd: "write", key: "a", val: "1"},
+				{cmd: "savepoint", key: "sp"},
+				{cmd: "write", key: "b", val: "1"},
+				{cmd: "rollbackto", key: "sp"},
+				{cmd: "commit"},
+			},
+			check: []testCase{{cmd: "readall", args: []string{}, want: `{"a":"1"}`}},
+		},
+		{
+			name: "flatten",
+			steps: []testCase{
+				{cmd: "begin"},
+				{cmd: "write", key: "a", val: "1"},
+				{cmd: "begin"},
+				{cmd: "write", key: "b", val: "1"},
+				{cmd: "flatten"},
+				{cmd: "commit"},
+			},
+			check: []testCase{{cmd: "readall", args: []string{}, want: `{"a":"1","b":"1"}`}},
+		},
+		{
+			name: "implicit transaction",
+			steps: []testCase{
+				{cmd: "autocommit", key: "off"},
+				{cmd: "write", key: "a", val: "1"},
+				{cmd: "begin"},
+				{cmd: "write", key: "b", val: "1"},
+				{cmd: "commit"},
+				{cmd: "commit"},
+			},
+			check: []testCase{{cmd: "readall", args: []string{}, want: `{"a":"1","b":"1"}`}},
+		},
+		{
+			name: "atomic in a transaction",
+			steps: []testCase{
+				{cmd: "write", key: "a1", val: "1"},
+				{cmd: "begin"},
+				{cmd: "renameprefix", key: "a", val: "b", want: "1"},
+				{cmd: "commit"},
+			},
+			check: []testCase{{cmd: "readall", args: []string{}, want: `{"b1":"1"}`}},
+		},
+		{
+			name: "compacted",
+			opts: []storage.Option{storage.WithFlushThreshold(1)},
+			steps: []testCase{
+				{cmd: "begin"},
+				{cmd: "write", key: "a", val: "1"},
+				{cmd: "write", key: "a", val: "2"},
+				{cmd: "begin"},
+				{cmd: "write", key: "b", val: "1"},
+				{cmd: "remove", key: "b"},
+				{cmd: "commit"},
+				{cmd: "commit"},
+			},
+			check: []testCase{{cmd: "readall", args: []string{}, want: `{"a":"2"}`}},
+		},
+	}
+
+	for _, seq := range sequences {
+		t.Run(seq.name, func(t *testing.T) {
+			store := storage.NewStore(seq.opts...)
+			for _, step := range seq.steps {
+				testStore(t, store, []testCase{step})
+				if step.cmd == "commit" {
+					testStore(t, store, []testCase{{cmd: "check", want: "ok"}})
+				}
+			}
+
+			testStore(t, store, []testCase{{cmd: "txsizes", want: "level 0: 0"}})
+			testStore(t, store, seq.check)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// diffFiles compares the snapshots in the files at pathA and pathB, as written
+// by the snapshot command. It returns a line per differing key, sorted by
+// key, in the format of the patch files: "+key value" for a key only in B,
+// "-key" for a key only in A, and "~key value" for a key with a different
+// value in B. Applied as a patch on the state of A, the diff results in the
+// state of B.
+func diffFiles(pathA, pathB string) (string, error) {
+	a, err := readSnapshotFile(pathA)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := readSnapshotFile(pathB)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(diffMaps(a, b), "\n"), nil
+}
+
+// readSnapshotFile returns the keys and values of the snapshot in the file at
+// path.
+func readSnapshotFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := readSnapshot(f)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(c.kv))
+	for k, e := range c.kv {
+		m[k] = e.value
+	}
+
+	return m, nil
+}
+
+// diffMaps returns the diff lines, sorted by key, from a to b.
+func diffMaps(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, k := range keys {
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inA:
+			lines = append(lines, fmt.Sprintf("%c%s %s", patchAdd, k, vb))
+		case !inB:
+			lines = append(lines, fmt.Sprintf("%c%s", patchRemove, k))
+		case va != vb:
+			lines = append(lines, fmt.Sprintf("%c%s %s", patchChange, k, vb))
+		}
+	}
+
+	return lines
+}
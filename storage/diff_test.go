@@ -0,0 +1,79 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.snap")
+	b := filepath.Join(dir, "b.snap")
+
+	test(t, []testCase{
+		{cmd: "write", key: "same", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "removed", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "changed", val: "old", want: "", wantErr: nil},
+		{cmd: "snapshot", key: a, val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "removed", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "changed", val: "new", want: "", wantErr: nil},
+		{cmd: "write", key: "added", val: "3", want: "", wantErr: nil},
+		{cmd: "snapshot", key: b, val: "", want: "", wantErr: nil},
+
+		{cmd: "difffiles", key: a, val: b, want: "+added 3\n~changed new\n-removed", wantErr: nil},
+		{cmd: "difffiles", key: b, val: a, want: "-added\n~changed old\n+removed 2", wantErr: nil},
+		{cmd: "difffiles", key: a, val: a, want: "", wantErr: nil},
+	})
+}
+
+func TestDiffFilesErrors(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.snap")
+	notSnapshot := writeFile(t, dir, "a.json", `{"a":"1"}`)
+
+	cases := []testCase{
+		{cmd: "snapshot", key: a, val: "", want: "", wantErr: nil},
+		{cmd: "difffiles", key: a, val: filepath.Join(dir, "missing"), want: "", wantErr: fs.ErrNotExist},
+		{cmd: "difffiles", key: filepath.Join(dir, "missing"), val: a, want: "", wantErr: fs.ErrNotExist},
+	}
+
+	test(t, cases)
+
+	store := storage.NewStore()
+	if _, err := store.Process("difffiles", a, notSnapshot); err == nil {
+		t.Errorf("\nGot Error 'nil' want the invalid snapshot")
+	}
+}
+
+func TestDiffFilesPatchRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.snap")
+	b := filepath.Join(dir, "b.snap")
+
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "same", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "removed", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "changed", val: "old value", want: "", wantErr: nil},
+		{cmd: "snapshot", key: a, val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "removed", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "changed", val: "new value", want: "", wantErr: nil},
+		{cmd: "write", key: "added", val: "", want: "", wantErr: nil},
+		{cmd: "snapshot", key: b, val: "", want: "", wantErr: nil},
+	})
+	want, _ := store.Process("storehash")
+
+	diff, err := store.Process("difffiles", a, b)
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+	patch := writeFile(t, dir, "a-b.patch", diff+"\n")
+
+	testStore(t, store, []testCase{
+		{cmd: "restore", key: a, val: "", want: "", wantErr: nil},
+		{cmd: "patch", key: patch, val: "", want: "3", wantErr: nil},
+		{cmd: "storehash", key: "", val: "", want: want, wantErr: nil},
+	})
+}
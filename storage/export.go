@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// createFile writes the file at path, replacing it, with write.
+func createFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// saveJSON writes v, JSON encoded, to the file at path, replacing it.
+func saveJSON(path string, v interface{}) error {
+	return createFile(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+// exportPrefix writes the keys of the effective keyspace starting with
+// prefix, and their values, to the file at path as a JSON object. It returns
+// the number of keys exported.
+func (s *Store) exportPrefix(prefix, path string) (int, error) {
+	keys := s.scan(prefix)
+	pairs := make(map[string]string, len(keys))
+	for _, k := range keys {
+		v, err := s.read(k)
+		if err != nil {
+			return 0, err
+		}
+
+		pairs[k] = v
+	}
+
+	return len(keys), saveJSON(path, pairs)
+}
+
+// ExportJSON writes the committed keyspace to w as a flat JSON object of keys
+// and values, the format read by the importjson command. Open transactions,
+// notes and expired keys are not exported.
+func (s *Store) ExportJSON(w io.Writer) error {
+	now := s.now()
+	pairs := make(map[string]string, len(s.kv))
+	for k, e := range s.kv {
+		if !e.expired(now) {
+			pairs[k] = e.value
+		}
+	}
+
+	return json.NewEncoder(w).Encode(pairs)
+}
+
+// exportJSON writes the committed keyspace to the file at path as a flat JSON
+// object, replacing the file.
+func (s *Store) exportJSON(path string) error {
+	return createFile(path, s.ExportJSON)
+}
+
+// importJSON writes the pairs of the flat JSON object in the file at path to
+// the committed state, like MergeWith. It returns the number of keys imported.
+//
+// importJSON returns error if a value is not a string, like a number or a
+// nested object. Then nothing is imported.
+func (s *Store) importJSON(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return 0, fmt.Errorf("%w: %s is not a JSON object: %s", ErrInvalidArgument, path, err)
+	}
+
+	pairs := make(map[string]string, len(obj))
+	for k, v := range obj {
+		str, ok := v.(string)
+		if !ok {
+			return 0, fmt.Errorf("%w: value of %s is not a string", ErrInvalidArgument, k)
+		}
+
+		pairs[k] = str
+	}
+
+	return len(pairs), s.MergeWith(pairs, nil)
+}
@@ -0,0 +1,48 @@
+package storage_test
+
+import (
+	"encoding/json"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportPrefix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.json")
+
+	test(t, []testCase{
+		{cmd: "write", key: "user:1", val: "Bob", want: "", wantErr: nil},
+		{cmd: "write", key: "user:2", val: "Alice", want: "", wantErr: nil},
+		{cmd: "write", key: "users", val: "all", want: "", wantErr: nil},
+		{cmd: "write", key: "config", val: "on", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "user:3", val: "Carol", want: "", wantErr: nil},
+		{cmd: "remove", key: "user:1", val: "", want: "", wantErr: nil},
+		{cmd: "exportprefix", key: "user:", val: path, want: "2", wantErr: nil},
+		{cmd: "exportprefix", key: "user:", val: filepath.Join(dir, "missing", "f.json"), want: "", wantErr: fs.ErrNotExist},
+	})
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	var pairs map[string]string
+	if err := json.Unmarshal(b, &pairs); err != nil {
+		t.Fatalf("\nGot invalid JSON '%s': %s", b, err)
+	}
+
+	store := storage.NewStore()
+	if err := store.MergeWith(pairs, nil); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "list", args: []string{}, want: "user:2\nuser:3", wantErr: nil},
+		{cmd: "read", key: "user:2", val: "", want: "Alice", wantErr: nil},
+		{cmd: "read", key: "user:3", val: "", want: "Carol", wantErr: nil},
+	})
+}
@@ -0,0 +1,38 @@
+package storage
+
+// Test hooks into the internals of the Store.
+
+// TxOperations returns the number of operations of the current transaction
+// of the Store s.
+func TxOperations(s *Store) int {
+	return len(s.currTx.operations)
+}
+
+// AppendRootOperation appends a write of the key and value to the operations
+// of the root transaction of the Store s, that should always be empty.
+func AppendRootOperation(s *Store, key, value string) {
+	root := s.currTx
+	for !root.isRoot() {
+		root = root.parent
+	}
+
+	root.operations = append(root.operations, operation{key: key, value: value, isWrite: true})
+}
+
+// MakeTxCycle makes the parent of the current transaction of the Store s point
+// to itself, so the root is not reachable anymore.
+func MakeTxCycle(s *Store) {
+	s.currTx.parent = s.currTx
+}
+
+// FailAOFSync closes the AOF file of the Store s under its writer and runs a
+// background sync, that then fails.
+func FailAOFSync(s *Store) {
+	s.aof.f.Close()
+	s.aof.backgroundSync()
+}
+
+// LRUKeys returns the number of keys tracked by the LRU of the Store s.
+func LRUKeys(s *Store) int {
+	return len(s.lru.elems)
+}
@@ -0,0 +1,153 @@
+package storage_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+// oracle is a reference model of the Store, simple enough to be obviously
+// correct. The committed data is a map and each open transaction is another
+// map, stacked on top of it. A transaction map holds the value written to a
+// key, or nil if the key was removed.
+//
+// A read looks for the key from the top of the stack down to the committed
+// data. A commit merges the top map into the one below it. A discard drops
+// it.
+type oracle struct {
+	committed map[string]string
+	stack     []map[string]*string
+}
+
+func newOracle() *oracle {
+	return &oracle{committed: make(map[string]string)}
+}
+
+func (o *oracle) read(key string) (string, bool) {
+	for i := len(o.stack) - 1; i >= 0; i-- {
+		if v, ok := o.stack[i][key]; ok {
+			if v == nil {
+				return "", false
+			}
+
+			return *v, true
+		}
+	}
+
+	v, ok := o.committed[key]
+	return v, ok
+}
+
+func (o *oracle) set(key string, value *string) {
+	if len(o.stack) > 0 {
+		o.stack[len(o.stack)-1][key] = value
+		return
+	}
+
+	if value == nil {
+		delete(o.committed, key)
+		return
+	}
+
+	o.committed[key] = *value
+}
+
+func (o *oracle) begin() {
+	o.stack = append(o.stack, make(map[string]*string))
+}
+
+func (o *oracle) commit() bool {
+	if len(o.stack) == 0 {
+		return false
+	}
+
+	top := o.stack[len(o.stack)-1]
+	o.stack = o.stack[:len(o.stack)-1]
+	for k, v := range top {
+		o.set(k, v)
+	}
+
+	return true
+}
+
+func (o *oracle) discard() {
+	if len(o.stack) > 0 {
+		o.stack = o.stack[:len(o.stack)-1]
+	}
+}
+
+// fuzzKeys are the keys of the fuzzed commands. Few keys, so commands often
+// touch the same ones.
+var fuzzKeys = []string{"a", "b", "c"}
+
+// FuzzStore applies a sequence of commands, decoded from the fuzzed bytes,
+// to a Store and to the oracle, and checks that both agree after each
+// command. Each byte is a command: the byte modulo 6 selects the command,
+// the next factors the key and the value.
+func FuzzStore(f *testing.F) {
+	// write, begin, write, read: the shortest sequences covering each
+	// transition.
+	seeds := [][]byte{
+		{0, 1},
+		{0, 3, 1},
+		{0, 3, 6, 1},
+		{0, 3, 3, 1, 4, 1},
+		{0, 3, 2, 1, 5, 1},
+		{0, 3, 2, 3, 1, 4, 4, 1},
+		{0, 3, 6, 3, 1, 7},
+	}
+
+	for _, s := range seeds {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, cmds []byte) {
+		store := storage.NewStore()
+		o := newOracle()
+
+		for i, b := range cmds {
+			key := fuzzKeys[int(b/6)%len(fuzzKeys)]
+			value := fmt.Sprint(b / 18)
+
+			switch b % 6 {
+			case 0:
+				if _, err := store.Process(storage.Write, key, value); err != nil {
+					t.Fatalf("\n%d: Got Error '%s' on write", i, err)
+				}
+				o.set(key, &value)
+			case 1:
+				got, err := store.Process(storage.Read, key)
+				want, ok := o.read(key)
+				if ok != (err == nil) || got != want {
+					t.Fatalf("\n%d: Got read '%s' (err '%v') want '%s' (found %t) for key '%s'", i, got, err, want, ok, key)
+				}
+			case 2:
+				_, err := store.Process(storage.Remove, key)
+				_, ok := o.read(key)
+				if ok != (err == nil) {
+					t.Fatalf("\n%d: Got remove Error '%v' want found %t for key '%s'", i, err, ok, key)
+				}
+
+				if ok {
+					o.set(key, nil)
+				}
+			case 3:
+				store.Process(storage.Begin)
+				o.begin()
+			case 4:
+				_, err := store.Process(storage.Commit)
+				if ok := o.commit(); ok != (err == nil) {
+					t.Fatalf("\n%d: Got commit Error '%v' want ok %t", i, err, ok)
+				}
+
+				if err != nil && !errors.Is(err, storage.ErrNoCurrentTransation) {
+					t.Fatalf("\n%d: Got commit Error '%s'", i, err)
+				}
+			case 5:
+				store.Process(storage.Discard)
+				o.discard()
+			}
+		}
+	})
+}
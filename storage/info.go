@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// info returns the uptime of the Store since its creation, the number of
+// commands processed, the info command included, and the number of open
+// transactions, one "name: value" per line. The uptime is measured with the
+// clock of the Store.
+func (s *Store) info() string {
+	lines := []string{
+		fmt.Sprintf("uptime: %s", s.now().Sub(s.startedAt)),
+		fmt.Sprintf("commands: %d", s.commands),
+		fmt.Sprintf("depth: %d", s.depth()),
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,31 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+	"time"
+)
+
+func TestInfo(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(100, 0)}
+	store := storage.NewStore(storage.WithClock(clock.now))
+
+	testStore(t, store, []testCase{
+		{cmd: "info", key: "", val: "", want: "uptime: 0s\ncommands: 1\ndepth: 0", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	clock.advance(90 * time.Second)
+	testStore(t, store, []testCase{
+		{cmd: "info", key: "", val: "", want: "uptime: 1m30s\ncommands: 6\ndepth: 2", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	clock.advance(time.Hour)
+	testStore(t, store, []testCase{
+		{cmd: "info", key: "", val: "", want: "uptime: 1h1m30s\ncommands: 8\ndepth: 1", wantErr: nil},
+	})
+}
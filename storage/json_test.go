@@ -0,0 +1,110 @@
+package storage_test
+
+import (
+	"bytes"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes content to the file name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	return path
+}
+
+func TestImportJSON(t *testing.T) {
+	dir := t.TempDir()
+	flat := writeFile(t, dir, "flat.json", `{"a":"1","b":"2","c":""}`)
+	empty := writeFile(t, dir, "empty.json", `{}`)
+
+	test(t, []testCase{
+		{cmd: "write", key: "a", val: "old", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "kept", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "pending", want: "", wantErr: nil},
+		{cmd: "importjson", key: flat, val: "", want: "3", wantErr: nil},
+		{cmd: "importjson", key: empty, val: "", want: "0", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "pending", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "kept", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+
+		// the imported keys are committed
+		{cmd: "read", key: "b", val: "", want: "2", wantErr: nil},
+	})
+}
+
+func TestImportJSONErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []testCase{
+		{cmd: "importjson", key: writeFile(t, dir, "nested.json", `{"a":"1","b":{"c":"2"}}`), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "importjson", key: writeFile(t, dir, "array.json", `{"a":["1"]}`), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "importjson", key: writeFile(t, dir, "number.json", `{"a":1}`), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "importjson", key: writeFile(t, dir, "null.json", `{"a":null}`), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "importjson", key: writeFile(t, dir, "list.json", `["a","b"]`), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "importjson", key: writeFile(t, dir, "invalid.json", `{"a":`), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "importjson", key: filepath.Join(dir, "missing.json"), want: "", wantErr: fs.ErrNotExist},
+
+		// a rejected file imports nothing
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	}
+
+	test(t, cases)
+}
+
+func TestExportJSONRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: `quo"te`, val: `say "hi"`, want: "", wantErr: nil},
+		{cmd: "write", key: `back\slash`, val: `c:\dir`, want: "", wantErr: nil},
+		{cmd: "write", key: "new\nline", val: "tab\there", want: "", wantErr: nil},
+		{cmd: "write", key: "<html>&", val: "ünïcödé ✓", want: "", wantErr: nil},
+		{cmd: "write", key: "empty", val: "", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "not exported", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "pending", val: "1", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "exportjson", key: path, val: "", want: "", wantErr: nil},
+	})
+
+	imported := storage.NewStore()
+	testStore(t, imported, []testCase{
+		{cmd: "importjson", key: path, val: "", want: "6", wantErr: nil},
+		{cmd: "read", key: "pending", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "note", key: "a", val: "", want: "", wantErr: nil},
+	})
+
+	var want, got bytes.Buffer
+	if err := store.ExportJSON(&want); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if err := imported.ExportJSON(&got); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if got.String() != want.String() {
+		t.Errorf("\nGot '%s' want '%s'", got.String(), want.String())
+	}
+}
+
+func TestExportJSONErrors(t *testing.T) {
+	cases := []testCase{
+		{cmd: "exportjson", key: filepath.Join(t.TempDir(), "missing", "f.json"), val: "", want: "", wantErr: fs.ErrNotExist},
+	}
+
+	test(t, cases)
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// scan returns the keys of the effective keyspace starting with prefix,
+// sorted.
+func (s *Store) scan(prefix string) []string {
+	var keys []string
+	for k := range s.view() {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// list returns the keys of the effective keyspace, sorted, one per line. The
+// optional arguments offset and limit select a window of the keys: limit keys
+// from the key offset. A limit lower than 1 means all the keys after offset.
+// Windows past the end are clamped.
+//
+// list returns ErrInvalidArgument if offset or limit are not integers, or if
+// offset is negative.
+func (s *Store) list(args []string) (string, error) {
+	offset, limit := 0, 0
+
+	var err error
+	if len(args) > 0 {
+		if offset, err = IntArg("offset", args[0], 0); err != nil {
+			return "", err
+		}
+	}
+
+	if len(args) > 1 {
+		if limit, err = IntArg("limit", args[1], math.MinInt); err != nil {
+			return "", err
+		}
+	}
+
+	keys := s.scan("")
+	if offset > len(keys) {
+		offset = len(keys)
+	}
+
+	end := len(keys)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	return strings.Join(keys[offset:end], "\n"), nil
+}
+
+// grep returns the keys of the effective keyspace whose value matches the
+// regular expression pattern, sorted, as key=value lines.
+//
+// grep returns ErrInvalidArgument if pattern is not a valid regular
+// expression.
+func (s *Store) grep(pattern string) (string, error) {
+	keys, view, err := s.matching(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = k + "=" + view[k]
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// matching returns the keys of the effective keyspace whose value matches the
+// regular expression pattern, sorted, and the effective keyspace.
+//
+// matching returns ErrInvalidArgument if pattern is not a valid regular
+// expression.
+func (s *Store) matching(pattern string) ([]string, map[string]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: pattern %s (%s)", ErrInvalidArgument, pattern, err)
+	}
+
+	view := s.view()
+	keys := make([]string, 0, len(view))
+	for k, v := range view {
+		if re.MatchString(v) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, view, nil
+}
+
+// deleteMatching removes the keys of the effective keyspace whose value
+// matches the regular expression pattern, like grep finds them. It returns
+// the number of keys removed.
+//
+// Like renamePrefix, the removes run in their own transaction, so a discard of
+// the current transaction reverts them together.
+//
+// deleteMatching returns ErrInvalidArgument if pattern is not a valid regular
+// expression, and ErrNoTransaction outside a transaction if transactions are
+// required.
+func (s *Store) deleteMatching(pattern string) (int, error) {
+	if err := s.checkTxRequired(); err != nil {
+		return 0, err
+	}
+
+	keys, _, err := s.matching(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.Atomic(func(tx *TxView) error {
+		for _, k := range keys {
+			if err := tx.Remove(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
+
+// mgetPrefix returns the keys of the effective keyspace starting with prefix,
+// sorted, as key=value lines.
+func (s *Store) mgetPrefix(prefix string) (string, error) {
+	keys := s.scan(prefix)
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		v, err := s.read(k)
+		if err != nil {
+			return "", err
+		}
+
+		lines[i] = k + "=" + v
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// sortByValue returns the keys of the effective keyspace as key=value lines,
+// sorted by value, and by key for equal values.
+func (s *Store) sortByValue() string {
+	view := s.view()
+	keys := make([]string, 0, len(view))
+	for k := range view {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		vi, vj := view[keys[i]], view[keys[j]]
+		if vi != vj {
+			return vi < vj
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = k + "=" + view[k]
+	}
+
+	return strings.Join(lines, "\n")
+}
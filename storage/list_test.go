@@ -0,0 +1,124 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	cases := []testCase{
+		{cmd: "list", args: []string{}, want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "4", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "5", want: "", wantErr: nil},
+
+		{cmd: "list", args: []string{}, want: "a\nc\nd\ne", wantErr: nil},
+		{cmd: "list", args: []string{"0", "2"}, want: "a\nc", wantErr: nil},
+		{cmd: "list", args: []string{"1", "2"}, want: "c\nd", wantErr: nil},
+		{cmd: "list", args: []string{"2"}, want: "d\ne", wantErr: nil},
+		{cmd: "list", args: []string{"3", "5"}, want: "e", wantErr: nil},
+		{cmd: "list", args: []string{"4", "1"}, want: "", wantErr: nil},
+		{cmd: "list", args: []string{"10", "1"}, want: "", wantErr: nil},
+		{cmd: "list", args: []string{"1", "0"}, want: "c\nd\ne", wantErr: nil},
+		{cmd: "list", args: []string{"1", "-1"}, want: "c\nd\ne", wantErr: nil},
+
+		{cmd: "list", args: []string{"-1", "1"}, want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "list", args: []string{"one"}, want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "list", args: []string{"0", "two"}, want: "", wantErr: storage.ErrInvalidArgument},
+	}
+
+	test(t, cases)
+}
+
+func TestGrep(t *testing.T) {
+	cases := []testCase{
+		{cmd: "grep", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "apple", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "banana", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "pineapple", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "1+1=2", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "(a|b)", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+
+		{cmd: "grep", key: "apple", val: "", want: "a=apple\nc=pineapple", wantErr: nil},
+		{cmd: "grep", key: "^apple$", val: "", want: "a=apple", wantErr: nil},
+		{cmd: "grep", key: "an", val: "", want: "", wantErr: nil},
+		{cmd: "grep", key: `^1\+1=`, val: "", want: "d=1+1=2", wantErr: nil},
+		{cmd: "grep", key: `\(a\|b\)`, val: "", want: "e=(a|b)", wantErr: nil},
+		{cmd: "grep", key: "^(a|p)", val: "", want: "a=apple\nc=pineapple", wantErr: nil},
+		{cmd: "grep", key: "(", val: "", want: "", wantErr: storage.ErrInvalidArgument},
+	}
+
+	test(t, cases)
+}
+
+func TestMGetPrefix(t *testing.T) {
+	cases := []testCase{
+		{cmd: "mgetprefix", key: "user:", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "user:1", val: "Bob", want: "", wantErr: nil},
+		{cmd: "write", key: "user:2", val: "Alice", want: "", wantErr: nil},
+		{cmd: "write", key: "users", val: "all", want: "", wantErr: nil},
+		{cmd: "write", key: "config", val: "on", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "user:3", val: "Carol", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "user:1", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "user:2", val: "Alice B", want: "", wantErr: nil},
+		{cmd: "mgetprefix", key: "user:", val: "", want: "user:2=Alice B\nuser:3=Carol", wantErr: nil},
+		{cmd: "mgetprefix", key: "user", val: "", want: "user:2=Alice B\nuser:3=Carol\nusers=all", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "mgetprefix", key: "user:", val: "", want: "user:1=Bob\nuser:2=Alice\nuser:3=Carol", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "mgetprefix", key: "user:", val: "", want: "user:1=Bob\nuser:2=Alice", wantErr: nil},
+		{cmd: "mgetprefix", key: "", val: "", want: "config=on\nuser:1=Bob\nuser:2=Alice\nusers=all", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestSortByValue(t *testing.T) {
+	cases := []testCase{
+		{cmd: "sortbyvalue", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "banana", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "apple", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "cherry", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "apple", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "Banana", want: "", wantErr: nil},
+		{cmd: "write", key: "aa", val: "apple", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "f", val: "", want: "", wantErr: nil},
+		{cmd: "sortbyvalue", key: "", val: "", want: "f=\ne=Banana\naa=apple\nb=apple\nd=banana\na=cherry", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestDeleteMatching(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a", val: "apple", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "banana", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "pineapple", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "cherry", want: "", wantErr: nil},
+		{cmd: "deletematching", key: "(", val: "", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "deletematching", key: "^kiwi$", val: "", want: "0", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "grapple", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "deletematching", key: "apple", val: "", want: "3", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "b\nd", wantErr: nil},
+		{cmd: "deletematching", key: "apple", val: "", want: "0", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a\nb\nc\nd\ne", wantErr: nil},
+		{cmd: "deletematching", key: "^(banana|cherry)$", val: "", want: "2", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a\nc\ne", wantErr: nil},
+	}
+
+	test(t, cases)
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+)
+
+// Logger receives the lifecycle events of a Store: transaction transitions
+// at debug level, commits reaching the kvStore at info level, and rejected
+// commands and torn AOF records at error level.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// nopLogger is the default Logger of a Store. It discards everything.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// WithLogger makes the Store log its lifecycle events to l.
+func WithLogger(l Logger) Option {
+	return func(s *Store) {
+		s.logger = l
+	}
+}
+
+// logging reports whether the Store has a Logger, other than the default one
+// discarding everything.
+func (s *Store) logging() bool {
+	_, nop := s.logger.(nopLogger)
+	return !nop
+}
+
+// writerLogger is the Logger of WithDebug. It writes the debug events to w,
+// one per line, and discards the others.
+type writerLogger struct {
+	w io.Writer
+}
+
+func (l writerLogger) Debugf(format string, args ...interface{}) {
+	fmt.Fprintf(l.w, format+"\n", args...)
+}
+
+func (writerLogger) Infof(format string, args ...interface{})  {}
+func (writerLogger) Errorf(format string, args ...interface{}) {}
@@ -0,0 +1,55 @@
+package storage_test
+
+import (
+	"fmt"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"reflect"
+	"testing"
+)
+
+// recordingLogger records the log calls as "level: message".
+type recordingLogger struct {
+	calls []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.calls = append(l.calls, "debug: "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Infof(format string, args ...interface{}) {
+	l.calls = append(l.calls, "info: "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.calls = append(l.calls, "error: "+fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	store := storage.NewStore(storage.WithLogger(logger))
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "z", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	})
+
+	want := []string{
+		"debug: begin: depth=1 ops=0",
+		"debug: begin: depth=2 ops=0",
+		"error: remove: Key not found: z",
+		"debug: discard: depth=1 ops=1",
+		"info: commit: applying 1 operations",
+		"debug: commit: depth=0 ops=0",
+		"error: commit: There is no current transaction to commit",
+	}
+
+	if !reflect.DeepEqual(logger.calls, want) {
+		t.Errorf("\nGot log calls '%q' want '%q'", logger.calls, want)
+	}
+}
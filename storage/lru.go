@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"container/list"
+	"sort"
+)
+
+// lru orders the keys by the recency of their last access, read or write.
+type lru struct {
+	// order holds the keys, the most recently accessed at the front.
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newLRU() *lru {
+	return &lru{order: list.New(), elems: make(map[string]*list.Element)}
+}
+
+// touch makes the key key the most recently accessed.
+func (l *lru) touch(key string) {
+	if el, ok := l.elems[key]; ok {
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.elems[key] = l.order.PushFront(key)
+}
+
+// forget removes the key key from the order.
+func (l *lru) forget(key string) {
+	if el, ok := l.elems[key]; ok {
+		l.order.Remove(el)
+		delete(l.elems, key)
+	}
+}
+
+// WithLRUEviction makes the Store evict the least recently used committed key
+// when the write of a new key exceeds the maximum number of keys, instead of
+// returning ErrMaxKeysExceeded. Reads and writes count as accesses. The keys
+// modified by an open transaction are not evicted.
+//
+// The eviction removes the key from the committed state, even if the write
+// that triggered it is in a transaction: discarding the transaction does not
+// bring the evicted key back.
+//
+// Without WithMaxKeys, WithLRUEviction has no effect.
+func WithLRUEviction() Option {
+	return func(s *Store) {
+		s.lru = newLRU()
+	}
+}
+
+// touch records the access to the key key, if the LRU eviction is enabled.
+func (s *Store) touch(key string) {
+	if s.lru != nil {
+		s.lru.touch(key)
+	}
+}
+
+// forget stops tracking the access to the removed key key, if the LRU
+// eviction is enabled.
+func (s *Store) forget(key string) {
+	if s.lru != nil {
+		s.lru.forget(key)
+	}
+}
+
+// rebuildLRU tracks again only the committed keys, after the committed state
+// was replaced. They are all as recently used, in key order, like the
+// committed keys never accessed.
+func (s *Store) rebuildLRU() {
+	if s.lru == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(s.kv))
+	for k := range s.kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	s.lru = newLRU()
+	for _, k := range keys {
+		s.lru.touch(k)
+	}
+}
+
+// forgetDiscarded stops tracking the keys of the discarded operations ops
+// that are neither committed nor in an open transaction anymore.
+func (s *Store) forgetDiscarded(ops []operation) {
+	if s.lru == nil {
+		return
+	}
+
+	for _, op := range ops {
+		if _, ok := s.kv[op.key]; ok {
+			continue
+		}
+
+		live := false
+		for t := s.currTx; !t.isRoot() && !live; t = t.parent {
+			_, live = t.lookup(op.key)
+		}
+
+		if !live {
+			s.lru.forget(op.key)
+		}
+	}
+}
+
+// evictLRU removes from the committed state the least recently used key not
+// modified by an open transaction. The committed keys never accessed are the
+// least recently used, in key order. The expired keys met are forgotten. It
+// returns false if the LRU eviction is not enabled or there is no key to
+// evict.
+func (s *Store) evictLRU() (bool, error) {
+	if s.lru == nil {
+		return false, nil
+	}
+
+	inTx := make(map[string]bool)
+	for t := s.currTx; !t.isRoot(); t = t.parent {
+		for _, op := range t.operations {
+			inTx[op.key] = true
+		}
+	}
+
+	now := s.now()
+	evictable := func(key string) bool {
+		e, ok := s.kv[key]
+		return ok && !e.expired(now) && !inTx[key]
+	}
+
+	var untracked []string
+	for k := range s.kv {
+		if _, ok := s.lru.elems[k]; !ok && evictable(k) {
+			untracked = append(untracked, k)
+		}
+	}
+
+	if len(untracked) > 0 {
+		sort.Strings(untracked)
+		return true, s.apply(operation{key: untracked[0]})
+	}
+
+	for el := s.lru.order.Back(); el != nil; {
+		key := el.Value.(string)
+		if evictable(key) {
+			return true, s.apply(operation{key: key})
+		}
+
+		// the keys expired or gone from the committed state are forgotten
+		// on the way.
+		prev := el.Prev()
+		if !inTx[key] {
+			s.lru.forget(key)
+		}
+		el = prev
+	}
+
+	return false, nil
+}
@@ -0,0 +1,162 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	store := storage.NewStore(storage.WithMaxKeys(3), storage.WithLRUEviction())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+		// a is accessed: b is the least recently used
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+		{cmd: "write", key: "d", val: "4", want: "", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		// c is overwritten: a is the least recently used
+		{cmd: "write", key: "c", val: "33", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "5", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "33", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "4", wantErr: nil},
+		{cmd: "read", key: "e", val: "", want: "5", wantErr: nil},
+	})
+}
+
+func TestLRUEvictionTransaction(t *testing.T) {
+	store := storage.NewStore(storage.WithMaxKeys(2), storage.WithLRUEviction())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		// a is the least recently used, but modified by the transaction
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "2", wantErr: nil},
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		// the keys of the transaction are not committed: nothing to evict
+		{cmd: "write", key: "d", val: "4", want: "", wantErr: storage.ErrMaxKeysExceeded},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		// the eviction is committed: the discard does not bring b back
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestLRUEvictionRejectedWrite(t *testing.T) {
+	store := storage.NewStore(storage.WithMaxKeys(2), storage.WithLRUEviction(), storage.WithNoShadowing())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+		// the write is rejected before evicting b
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: storage.ErrDuplicateKeyInTx},
+		{cmd: "read", key: "b", val: "", want: "2", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "2", wantErr: nil},
+	})
+}
+
+func TestLRUEvictionForgetsKeys(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	store := storage.NewStore(storage.WithMaxKeys(3), storage.WithLRUEviction(), storage.WithClock(clock.now))
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "sp", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "11", want: "", wantErr: nil},
+		{cmd: "rollbackto", key: "sp", val: "", want: "", wantErr: nil},
+	})
+
+	// c is gone with the rollback, a is still committed.
+	if n := storage.LRUKeys(store); n != 2 {
+		t.Errorf("\nGot %d keys in the LRU want 2", n)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	if n := storage.LRUKeys(store); n != 1 {
+		t.Errorf("\nGot %d keys in the LRU want 1", n)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "setex", args: []string{"b", "1", "2"}, want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+	})
+
+	// b expires: it is forgotten instead of evicted, and c is evicted.
+	clock.advance(2 * time.Second)
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "d", val: "4", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "5", want: "", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+
+	if n := storage.LRUKeys(store); n != 3 {
+		t.Errorf("\nGot %d keys in the LRU want 3", n)
+	}
+}
+
+func TestLRUEvictionRestore(t *testing.T) {
+	store := storage.NewStore(storage.WithMaxKeys(2), storage.WithLRUEviction())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "checkpoint", key: "c0", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+		{cmd: "restorecheckpoint", key: "c0", val: "", want: "", wantErr: nil},
+	})
+
+	if n := storage.LRUKeys(store); n != 2 {
+		t.Errorf("\nGot %d keys in the LRU want 2", n)
+	}
+
+	// the restored keys are least recently used in key order.
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "d", val: "4", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b", val: "", want: "2", wantErr: nil},
+	})
+}
+
+func TestLRUEvictionUntracked(t *testing.T) {
+	store := storage.NewStore(storage.WithMaxKeys(3), storage.WithLRUEviction())
+	if err := store.MergeWith(map[string]string{"b": "1", "a": "1"}, nil); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	// the merged keys were never accessed, and are evicted first
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "c", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "f", val: "1", want: "", wantErr: nil},
+		{cmd: "readall", args: []string{}, want: `{"d":"1","e":"1","f":"1"}`, wantErr: nil},
+	})
+}
+
+func TestLRUEvictionDisabled(t *testing.T) {
+	store := storage.NewStore(storage.WithLRUEviction())
+	for _, k := range []string{"a", "b", "c"} {
+		testStore(t, store, []testCase{
+			{cmd: "write", key: k, val: "1", want: "", wantErr: nil},
+		})
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+	})
+}
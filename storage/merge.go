@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"sort"
+)
+
+// MergeWith writes the keys of other to the committed state. The existing
+// keys are kept. For a key in both, resolve returns the value to keep from
+// the existing and the incoming values, so it can keep either or combine
+// them. A nil resolve takes the incoming value.
+//
+// Open transactions are kept, and see the merged keys as committed.
+func (s *Store) MergeWith(other map[string]string, resolve func(key, existing, incoming string) string) error {
+	if resolve == nil {
+		resolve = takeIncoming
+	}
+
+	keys := make([]string, 0, len(other))
+	for k := range other {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	now := s.now()
+	for _, k := range keys {
+		v := other[k]
+		k = s.normalize(k)
+		if e, ok := s.kv[k]; ok && !e.expired(now) {
+			v = resolve(k, e.value, v)
+		}
+
+		if err := s.apply(operation{key: k, value: v, isWrite: true}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// takeIncoming is the default resolver of MergeWith.
+func takeIncoming(key, existing, incoming string) string {
+	return incoming
+}
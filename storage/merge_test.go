@@ -0,0 +1,46 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+func TestMergeWith(t *testing.T) {
+	concat := func(key, existing, incoming string) string {
+		return existing + "+" + incoming
+	}
+
+	keepExisting := func(key, existing, incoming string) string {
+		return existing
+	}
+
+	resolvers := map[string]struct {
+		resolve func(key, existing, incoming string) string
+		want    string
+	}{
+		"default":  {resolve: nil, want: "other b"},
+		"concat":   {resolve: concat, want: "mine b+other b"},
+		"existing": {resolve: keepExisting, want: "mine b"},
+	}
+
+	for name, r := range resolvers {
+		t.Run(name, func(t *testing.T) {
+			store := storage.NewStore()
+			testStore(t, store, []testCase{
+				{cmd: "write", key: "a", val: "mine a", want: "", wantErr: nil},
+				{cmd: "write", key: "b", val: "mine b", want: "", wantErr: nil},
+			})
+
+			other := map[string]string{"b": "other b", "c": "other c"}
+			if err := store.MergeWith(other, r.resolve); err != nil {
+				t.Fatalf("\nGot Error '%s' want 'nil'", err)
+			}
+
+			testStore(t, store, []testCase{
+				{cmd: "read", key: "a", val: "", want: "mine a", wantErr: nil},
+				{cmd: "read", key: "b", val: "", want: r.want, wantErr: nil},
+				{cmd: "read", key: "c", val: "", want: "other c", wantErr: nil},
+			})
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PromFlag makes the metrics command render the counters in the Prometheus
+// text exposition format.
+const PromFlag = "--prom"
+
+// promPrefix is the prefix of the metric names in the Prometheus format.
+const promPrefix = "kv_"
+
+var ErrInvalidFlag error = errors.New("Invalid flag")
+
+// metrics are the counters of the keyspace events of a Store since its
+// creation.
+//
+// writes and removes count the attempted mutations, wherever they end. Once
+// their transaction is resolved, they are counted as applied, when written
+// to the kvStore, or as discarded.
+type metrics struct {
+	reads    uint64
+	writes   uint64
+	removes  uint64
+	commits  uint64
+	discards uint64
+
+	appliedOps   uint64
+	discardedOps uint64
+
+	// rootCommits, lastCommit and totalCommit time the commits that reach the
+	// kvStore.
+	rootCommits uint64
+	lastCommit  time.Duration
+	totalCommit time.Duration
+}
+
+// counter is a named counter of the metrics.
+type counter struct {
+	name  string
+	help  string
+	value uint64
+}
+
+// counters returns the counters of the metrics m in a fixed order.
+func (m metrics) counters() []counter {
+	return []counter{
+		{name: "reads", help: "Number of reads.", value: m.reads},
+		{name: "writes", help: "Number of attempted writes.", value: m.writes},
+		{name: "removes", help: "Number of attempted removes.", value: m.removes},
+		{name: "commits", help: "Number of commits.", value: m.commits},
+		{name: "discards", help: "Number of discarded transactions.", value: m.discards},
+		{name: "applied_operations", help: "Number of operations applied to the kv.", value: m.appliedOps},
+		{name: "discarded_operations", help: "Number of operations of discarded transactions.", value: m.discardedOps},
+	}
+}
+
+// render returns the counters of the metrics m, one "name: value" per line.
+func (m metrics) render() string {
+	var b strings.Builder
+	for i, c := range m.counters() {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "%s: %d", c.name, c.value)
+	}
+
+	return b.String()
+}
+
+// renderProm returns the counters of the metrics m in the Prometheus text
+// exposition format.
+func (m metrics) renderProm() string {
+	var b strings.Builder
+	for _, c := range m.counters() {
+		name := promPrefix + c.name + "_total"
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, c.help)
+		fmt.Fprintf(&b, "# TYPE %s counter\n", name)
+		fmt.Fprintf(&b, "%s %d\n", name, c.value)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// recordCommit adds the duration d of a commit that reached the kvStore to the
+// metrics m.
+func (m *metrics) recordCommit(d time.Duration) {
+	m.rootCommits++
+	m.lastCommit = d
+	m.totalCommit += d
+}
+
+// commitTiming returns the duration of the last commit that reached the
+// kvStore and the average of all of them, 0 if there is none.
+func (m metrics) commitTiming() string {
+	var avg time.Duration
+	if m.rootCommits > 0 {
+		avg = m.totalCommit / time.Duration(m.rootCommits)
+	}
+
+	return fmt.Sprintf("last: %s\naverage: %s", m.lastCommit, avg)
+}
+
+// processMetrics renders the metrics of the Store, in the Prometheus format if
+// the flag is PromFlag.
+//
+// processMetrics returns error if the flag is not empty or PromFlag.
+func (s *Store) processMetrics(flag string) (string, error) {
+	switch flag {
+	case "":
+		return s.metrics.render(), nil
+	case PromFlag:
+		return s.metrics.renderProm(), nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrInvalidFlag, flag)
+}
@@ -0,0 +1,138 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "z", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "metrics", key: "", val: "", want: "reads: 2\n" +
+			"writes: 4\n" +
+			"removes: 3\n" +
+			"commits: 1\n" +
+			"discards: 1\n" +
+			"applied_operations: 3\n" +
+			"discarded_operations: 3", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+// promLine matches the sample lines of the Prometheus text format without
+// labels.
+var promLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*) [0-9]+$`)
+
+// promComment matches the HELP and TYPE lines of the Prometheus text format.
+var promComment = regexp.MustCompile(`^# (HELP|TYPE) ([a-zA-Z_:][a-zA-Z0-9_:]*) (.+)$`)
+
+func TestMetricsProm(t *testing.T) {
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "metrics", key: "--json", val: "", want: "", wantErr: storage.ErrInvalidFlag},
+	})
+
+	out, err := store.Process("metrics", "--prom")
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	samples := make(map[string]string)
+	typed := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		if m := promComment.FindStringSubmatch(line); m != nil {
+			if m[1] == "TYPE" {
+				if m[3] != "counter" {
+					t.Errorf("\nGot type '%s' want 'counter'", m[3])
+				}
+
+				typed[m[2]] = true
+			}
+			continue
+		}
+
+		m := promLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("\nGot invalid line '%s'", line)
+		}
+
+		if !typed[m[1]] {
+			t.Errorf("\nGot sample '%s' without TYPE", m[1])
+		}
+
+		samples[m[1]] = line
+	}
+
+	for _, name := range []string{"reads", "writes", "removes", "commits", "discards", "applied_operations", "discarded_operations"} {
+		if _, ok := samples["kv_"+name+"_total"]; !ok {
+			t.Errorf("\nGot no sample for counter '%s'", name)
+		}
+	}
+
+	if samples["kv_writes_total"] != "kv_writes_total 1" {
+		t.Errorf("\nGot '%s' want 'kv_writes_total 1'", samples["kv_writes_total"])
+	}
+}
+
+func TestCommitTiming(t *testing.T) {
+	// every reading of the clock advances it by step, so a commit, that reads
+	// it at its start and end, takes step.
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	var step time.Duration
+	tick := func() time.Time {
+		clock.advance(step)
+		return clock.now()
+	}
+
+	store := storage.NewStore(storage.WithClock(tick))
+	testStore(t, store, []testCase{
+		{cmd: "committiming", key: "", val: "", want: "last: 0s\naverage: 0s", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+	})
+
+	steps := []struct {
+		step time.Duration
+		want string
+	}{
+		{step: 10 * time.Millisecond, want: "last: 10ms\naverage: 10ms"},
+		{step: 30 * time.Millisecond, want: "last: 30ms\naverage: 20ms"},
+		{step: 5 * time.Millisecond, want: "last: 5ms\naverage: 15ms"},
+	}
+
+	for _, s := range steps {
+		step = s.step
+		testStore(t, store, []testCase{
+			{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		})
+
+		step = 0
+		testStore(t, store, []testCase{
+			{cmd: "committiming", key: "", val: "", want: s.want, wantErr: nil},
+			// a nested commit does not reach the kvStore: not timed.
+			{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+			{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+			{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+			{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+			{cmd: "committiming", key: "", val: "", want: s.want, wantErr: nil},
+		})
+	}
+}
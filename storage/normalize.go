@@ -0,0 +1,23 @@
+package storage
+
+import "strings"
+
+// WithKeyNormalization makes the Store normalize the keys before use: the
+// leading and trailing whitespace is trimmed, and the internal runs of
+// whitespace are collapsed to a single space. " a  b " and "a b" are then the
+// same key, for the commands as for Atomic, MergeWith and the imports.
+func WithKeyNormalization() Option {
+	return func(s *Store) {
+		s.normalizeKeys = true
+	}
+}
+
+// normalize returns the key key normalized, if the normalization is enabled,
+// and key otherwise.
+func (s *Store) normalize(key string) string {
+	if !s.normalizeKeys {
+		return key
+	}
+
+	return strings.Join(strings.Fields(key), " ")
+}
@@ -0,0 +1,70 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+func TestKeyNormalization(t *testing.T) {
+	store := storage.NewStore(storage.WithKeyNormalization())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: " a  b ", val: "hi", want: "", wantErr: nil},
+		{cmd: "read", key: "a b", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "\ta \n b", val: "", want: "hi", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a b  ", val: "bye", want: "", wantErr: nil},
+		{cmd: "txkeys", key: "", val: "", want: "a b", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: " a b", val: "", want: "bye", wantErr: nil},
+		{cmd: "remove", key: "a   b", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestNoKeyNormalization(t *testing.T) {
+	test(t, []testCase{
+		{cmd: "write", key: " a  b ", val: "hi", want: "", wantErr: nil},
+		{cmd: "read", key: "a b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: " a  b ", val: "", want: "hi", wantErr: nil},
+	})
+}
+
+func TestKeyNormalizationAPI(t *testing.T) {
+	store := storage.NewStore(storage.WithKeyNormalization())
+	err := store.Atomic(func(tx *storage.TxView) error {
+		if err := tx.Write(" a  b ", "atomic"); err != nil {
+			return err
+		}
+
+		return tx.Write("c\td", "atomic")
+	})
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if err := store.MergeWith(map[string]string{"  e   f": "merged"}, nil); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a b", val: "", want: "atomic", wantErr: nil},
+		{cmd: "read", key: "e f", val: "", want: "merged", wantErr: nil},
+		{cmd: "annotate", key: " a b", val: "note", want: "", wantErr: nil},
+		{cmd: "note", key: "a  b", val: "", want: "note", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "e   f", val: "tx", want: "", wantErr: nil},
+		{cmd: "explain", key: " e f ", val: "", want: "tx (tx level 1)", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a b\nc d\ne f", wantErr: nil},
+	})
+
+	err = store.Atomic(func(tx *storage.TxView) error {
+		return tx.Remove("c  d")
+	})
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "c d", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
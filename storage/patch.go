@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// patch change kinds, the first character of a patch line.
+const (
+	patchAdd    = '+'
+	patchRemove = '-'
+	patchChange = '~'
+)
+
+// patchLine is a change of a patch file.
+type patchLine struct {
+	kind  byte
+	key   string
+	value string
+}
+
+// parsePatchLine returns the change of the patch line line: "+key value"
+// writes a key, "-key" removes it and "~key value" changes the value of an
+// existing key. The value is the rest of the line, and can contain spaces.
+func parsePatchLine(line string) (patchLine, error) {
+	if len(line) < 2 {
+		return patchLine{}, fmt.Errorf("%w: patch line %q", ErrInvalidArgument, line)
+	}
+
+	p := patchLine{kind: line[0]}
+	switch p.kind {
+	case patchAdd, patchChange:
+		key, value, ok := strings.Cut(line[1:], " ")
+		if !ok || key == "" {
+			return patchLine{}, fmt.Errorf("%w: patch line %q", ErrInvalidArgument, line)
+		}
+
+		p.key, p.value = key, value
+	case patchRemove:
+		if strings.Contains(line, " ") {
+			return patchLine{}, fmt.Errorf("%w: patch line %q", ErrInvalidArgument, line)
+		}
+
+		p.key = line[1:]
+	default:
+		return patchLine{}, fmt.Errorf("%w: patch line %q", ErrInvalidArgument, line)
+	}
+
+	return p, nil
+}
+
+// readPatch returns the changes of the patch file at path. Blank lines are
+// skipped. Lines can be arbitrarily long: ReadString grows its result past
+// the size of the reader buffer, unlike a bufio.Scanner.
+func readPatch(path string) ([]patchLine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []patchLine
+	rd := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		t, err := rd.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if len(t) == 0 {
+			return lines, nil
+		}
+
+		t = strings.TrimSuffix(strings.TrimSuffix(t, "\n"), "\r")
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+
+		p, err := parsePatchLine(t)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		lines = append(lines, p)
+	}
+}
+
+// applyPatch applies the changes of the patch file at path, in order. It
+// returns the number of changes applied.
+//
+// The changes run in their own transaction, so they are all part of the
+// current transaction, if any, and a discard reverts them together. If the
+// file has an invalid line, or a change fails, nothing is applied.
+//
+// applyPatch returns ErrNoTransaction outside a transaction if transactions
+// are required.
+func (s *Store) applyPatch(path string) (int, error) {
+	if err := s.checkTxRequired(); err != nil {
+		return 0, err
+	}
+
+	lines, err := readPatch(path)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.Atomic(func(tx *TxView) error {
+		for _, p := range lines {
+			switch p.kind {
+			case patchRemove:
+				if err := tx.Remove(p.key); err != nil {
+					return err
+				}
+			case patchChange:
+				if _, err := tx.Read(p.key); err != nil {
+					return err
+				}
+
+				fallthrough
+			case patchAdd:
+				if err := tx.Write(p.key, p.value); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(lines), nil
+}
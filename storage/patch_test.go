@@ -0,0 +1,72 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "changes.patch", "+c hello world\n\n-b\n~a 2\n+d \n")
+
+	test(t, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "1", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "patch", key: path, val: "", want: "4", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "2", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "hello world", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "", wantErr: nil},
+
+		// the whole patch is discarded with the transaction
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "d", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+
+		// and committed with it
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "patch", key: path, val: "", want: "4", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "2", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestPatchErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "patch", key: writeFile(t, dir, "kind.patch", "+b 1\n*a 2\n"), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "patch", key: writeFile(t, dir, "novalue.patch", "~a\n"), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "patch", key: writeFile(t, dir, "noaddvalue.patch", "+b\n"), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "patch", key: writeFile(t, dir, "nokey.patch", "+ 1\n"), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "patch", key: writeFile(t, dir, "remove.patch", "-a 1\n"), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "patch", key: writeFile(t, dir, "short.patch", "-\n"), want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "patch", key: writeFile(t, dir, "missing.patch", "+b 1\n-c\n"), want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "patch", key: writeFile(t, dir, "change.patch", "+b 1\n~c 1\n"), want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "patch", key: filepath.Join(dir, "none.patch"), want: "", wantErr: fs.ErrNotExist},
+
+		// a failed patch applies nothing
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	}
+
+	test(t, cases)
+}
+
+func TestPatchLongLine(t *testing.T) {
+	value := strings.Repeat("0123456789", 10000)
+	path := writeFile(t, t.TempDir(), "long.patch", "+a "+value+"\n~a "+value+value)
+
+	test(t, []testCase{
+		{cmd: "patch", key: path, val: "", want: "2", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: value + value, wantErr: nil},
+	})
+}
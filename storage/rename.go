@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"strings"
+)
+
+// keyCopy is a key of the effective keyspace to write to target, with its
+// entry and note, as read before the writes.
+type keyCopy struct {
+	key    string
+	target string
+	e      entry
+	note   string
+}
+
+// prefixCopies returns the copies of the keys of the effective keyspace
+// starting with oldPrefix to the keys with newPrefix instead. The keys that
+// would be copied to themselves are skipped.
+func (s *Store) prefixCopies(oldPrefix, newPrefix string) ([]keyCopy, error) {
+	var copies []keyCopy
+	for _, k := range s.scan(oldPrefix) {
+		target := newPrefix + strings.TrimPrefix(k, oldPrefix)
+		if target == k {
+			continue
+		}
+
+		e, err := s.readEntry(k)
+		if err != nil {
+			return nil, err
+		}
+
+		note, err := s.note(k)
+		if err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, keyCopy{key: k, target: target, e: e, note: note})
+	}
+
+	return copies, nil
+}
+
+// writeCopy writes the copy c to its target, with the expiration and the note
+// of the copied key. A note of the target is replaced, even by no note.
+func (s *Store) writeCopy(c keyCopy) error {
+	// a missing target has no note.
+	prev, _ := s.note(c.target)
+
+	if err := s.writeEntry(c.target, c.e); err != nil {
+		return err
+	}
+
+	if c.note == "" && prev == "" {
+		return nil
+	}
+
+	return s.modify(operation{key: c.target, value: c.note, isWrite: true, isNote: true})
+}
+
+// renamePrefix renames every key of the effective keyspace starting with
+// oldPrefix to the key with newPrefix instead, with its expiration and note.
+// The keys are renamed at once: a renamed key can take the name of another
+// renamed key. It returns the number of keys renamed. A key renamed to itself
+// is left untouched, and not counted.
+//
+// The renames run in their own transaction, so they are all part of the
+// current transaction, if any, and a discard reverts them together. Each key
+// is modified once in it: the keys taking the name of another are
+// overwritten, not removed first.
+//
+// renamePrefix returns ErrNoTransaction outside a transaction if transactions
+// are required.
+func (s *Store) renamePrefix(oldPrefix, newPrefix string) (int, error) {
+	if err := s.checkTxRequired(); err != nil {
+		return 0, err
+	}
+
+	copies, err := s.prefixCopies(oldPrefix, newPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	targets := make(map[string]bool, len(copies))
+	for _, c := range copies {
+		targets[c.target] = true
+	}
+
+	err = s.Atomic(func(tx *TxView) error {
+		for _, c := range copies {
+			if targets[c.key] {
+				continue
+			}
+
+			if err := tx.Remove(c.key); err != nil {
+				return err
+			}
+		}
+
+		for _, c := range copies {
+			if err := s.writeCopy(c); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(copies), nil
+}
+
+// copyPrefix writes a copy of every key of the effective keyspace starting
+// with srcPrefix to the key with dstPrefix instead, with its expiration and
+// note. The source keys are kept. The keys are copied at once: a copy can
+// overwrite another source key, and is not copied again. It returns the
+// number of keys copied. A key copied to itself is skipped, and not counted.
+//
+// Like renamePrefix, the copies run in their own transaction, so a discard of
+// the current transaction reverts them together, and copyPrefix returns
+// ErrNoTransaction outside a transaction if transactions are required.
+func (s *Store) copyPrefix(srcPrefix, dstPrefix string) (int, error) {
+	if err := s.checkTxRequired(); err != nil {
+		return 0, err
+	}
+
+	copies, err := s.prefixCopies(srcPrefix, dstPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.Atomic(func(tx *TxView) error {
+		for _, c := range copies {
+			if err := s.writeCopy(c); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(copies), nil
+}
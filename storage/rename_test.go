@@ -0,0 +1,168 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+	"time"
+)
+
+func TestRenamePrefix(t *testing.T) {
+	cases := []testCase{
+		{cmd: "renameprefix", key: "user:", val: "member:", want: "0", wantErr: nil},
+		{cmd: "write", key: "user:1", val: "Bob", want: "", wantErr: nil},
+		{cmd: "write", key: "user:2", val: "Alice", want: "", wantErr: nil},
+		{cmd: "write", key: "users", val: "all", want: "", wantErr: nil},
+		{cmd: "renameprefix", key: "user:", val: "member:", want: "2", wantErr: nil},
+		{cmd: "read", key: "member:1", val: "", want: "Bob", wantErr: nil},
+		{cmd: "read", key: "member:2", val: "", want: "Alice", wantErr: nil},
+		{cmd: "read", key: "user:1", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "users", val: "", want: "all", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	}
+
+	test(t, cases)
+}
+
+func TestRenamePrefixOverlapping(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a1", val: "one", want: "", wantErr: nil},
+		{cmd: "write", key: "ab1", val: "two", want: "", wantErr: nil},
+		{cmd: "write", key: "b1", val: "three", want: "", wantErr: nil},
+		{cmd: "renameprefix", key: "a", val: "ab", want: "2", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "ab1\nabb1\nb1", wantErr: nil},
+		{cmd: "read", key: "ab1", val: "", want: "one", wantErr: nil},
+		{cmd: "read", key: "abb1", val: "", want: "two", wantErr: nil},
+		{cmd: "renameprefix", key: "ab", val: "a", want: "2", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a1\nab1\nb1", wantErr: nil},
+		{cmd: "read", key: "a1", val: "", want: "one", wantErr: nil},
+		{cmd: "read", key: "ab1", val: "", want: "two", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestRenamePrefixDiscard(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a1", val: "one", want: "", wantErr: nil},
+		{cmd: "write", key: "a2", val: "two", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a3", val: "three", want: "", wantErr: nil},
+		{cmd: "renameprefix", key: "a", val: "b", want: "3", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "b1\nb2\nb3", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a1\na2", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestRenamePrefixExpirationAndNote(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	store := storage.NewStore(storage.WithClock(clock.now))
+
+	testStore(t, store, []testCase{
+		{cmd: "setex", args: []string{"a1", "10", "one"}, want: "", wantErr: nil},
+		{cmd: "annotate", key: "a1", val: "first", want: "", wantErr: nil},
+		{cmd: "write", key: "a2", val: "two", want: "", wantErr: nil},
+		{cmd: "write", key: "b2", val: "old", want: "", wantErr: nil},
+		{cmd: "annotate", key: "b2", val: "stale", want: "", wantErr: nil},
+		{cmd: "renameprefix", key: "a", val: "b", want: "2", wantErr: nil},
+		{cmd: "note", key: "b1", val: "", want: "first", wantErr: nil},
+		// the note of the overwritten key is not kept
+		{cmd: "note", key: "b2", val: "", want: "", wantErr: nil},
+	})
+
+	clock.advance(10 * time.Second)
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "b1", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b2", val: "", want: "two", wantErr: nil},
+	})
+}
+
+func TestRenamePrefixNoShadowing(t *testing.T) {
+	store := storage.NewStore(storage.WithNoShadowing())
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a1", val: "one", want: "", wantErr: nil},
+		{cmd: "write", key: "ab1", val: "two", want: "", wantErr: nil},
+		{cmd: "renameprefix", key: "a", val: "ab", want: "2", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "ab1\nabb1", wantErr: nil},
+		// an identity rename touches nothing
+		{cmd: "renameprefix", key: "ab", val: "ab", want: "0", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "ab1\nabb1", wantErr: nil},
+	})
+}
+
+func TestCopyPrefix(t *testing.T) {
+	cases := []testCase{
+		{cmd: "copyprefix", key: "user:", val: "backup:", want: "0", wantErr: nil},
+		{cmd: "write", key: "user:1", val: "Bob", want: "", wantErr: nil},
+		{cmd: "write", key: "user:2", val: "Alice", want: "", wantErr: nil},
+		{cmd: "write", key: "users", val: "all", want: "", wantErr: nil},
+		{cmd: "write", key: "backup:2", val: "old", want: "", wantErr: nil},
+		{cmd: "copyprefix", key: "user:", val: "backup:", want: "2", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "backup:1\nbackup:2\nuser:1\nuser:2\nusers", wantErr: nil},
+		{cmd: "read", key: "backup:1", val: "", want: "Bob", wantErr: nil},
+		{cmd: "read", key: "backup:2", val: "", want: "Alice", wantErr: nil},
+		{cmd: "read", key: "user:1", val: "", want: "Bob", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	}
+
+	test(t, cases)
+}
+
+func TestCopyPrefixOverlapping(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a1", val: "one", want: "", wantErr: nil},
+		{cmd: "write", key: "ab1", val: "two", want: "", wantErr: nil},
+		{cmd: "copyprefix", key: "a", val: "ab", want: "2", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a1\nab1\nabb1", wantErr: nil},
+		{cmd: "read", key: "a1", val: "", want: "one", wantErr: nil},
+		{cmd: "read", key: "ab1", val: "", want: "one", wantErr: nil},
+		{cmd: "read", key: "abb1", val: "", want: "two", wantErr: nil},
+		{cmd: "copyprefix", key: "ab", val: "a", want: "2", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a1\nab1\nabb1", wantErr: nil},
+		{cmd: "read", key: "a1", val: "", want: "one", wantErr: nil},
+		{cmd: "read", key: "ab1", val: "", want: "two", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestCopyPrefixDiscard(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a1", val: "one", want: "", wantErr: nil},
+		{cmd: "write", key: "b1", val: "old", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a2", val: "two", want: "", wantErr: nil},
+		{cmd: "copyprefix", key: "a", val: "b", want: "2", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a1\na2\nb1\nb2", wantErr: nil},
+		{cmd: "read", key: "b1", val: "", want: "one", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "list", args: []string{}, want: "a1\nb1", wantErr: nil},
+		{cmd: "read", key: "b1", val: "", want: "old", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestCopyPrefixExpirationAndNote(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	store := storage.NewStore(storage.WithClock(clock.now))
+
+	testStore(t, store, []testCase{
+		{cmd: "setex", args: []string{"a1", "10", "one"}, want: "", wantErr: nil},
+		{cmd: "annotate", key: "a1", val: "first", want: "", wantErr: nil},
+		{cmd: "write", key: "a2", val: "two", want: "", wantErr: nil},
+		{cmd: "copyprefix", key: "a", val: "b", want: "2", wantErr: nil},
+		{cmd: "note", key: "b1", val: "", want: "first", wantErr: nil},
+		{cmd: "copyprefix", key: "a", val: "a", want: "0", wantErr: nil},
+	})
+
+	clock.advance(10 * time.Second)
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a1", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b1", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b2", val: "", want: "two", wantErr: nil},
+	})
+}
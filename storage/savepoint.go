@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrSavepointNotFound error = errors.New("Savepoint not found")
+
+// savepoint is a named position in the operations of a transaction: the
+// number of operations when it was defined.
+type savepoint struct {
+	name  string
+	index int
+}
+
+// compactOperations compacts the operations of the transaction t after its
+// last savepoint. The operations before it are kept as they are, so a
+// rollback to any savepoint still finds them.
+func (t *tx) compactOperations() {
+	from := 0
+	if n := len(t.savepoints); n > 0 {
+		from = t.savepoints[n-1].index
+	}
+
+	t.operations = append(t.operations[:from:from], compact(t.operations[from:])...)
+	t.index = nil
+}
+
+// savepoint defines the savepoint name at the current end of the operations
+// of the current transaction, replacing any savepoint with the same name.
+//
+// savepoint returns error if there is no current transaction.
+func (s *Store) savepoint(name string) error {
+	if s.currTx.isRoot() {
+		return ErrNoCurrentTransation
+	}
+
+	t := s.currTx
+	for i, sp := range t.savepoints {
+		if sp.name == name {
+			t.savepoints = append(t.savepoints[:i], t.savepoints[i+1:]...)
+			break
+		}
+	}
+
+	t.savepoints = append(t.savepoints, savepoint{name: name, index: len(t.operations)})
+	return nil
+}
+
+// rollbackTo discards the operations of the current transaction after the
+// savepoint name. The savepoint is kept, the ones defined after it are
+// removed.
+//
+// rollbackTo returns error if there is no current transaction, or if it has
+// no savepoint name.
+func (s *Store) rollbackTo(name string) error {
+	if s.currTx.isRoot() {
+		return ErrNoCurrentTransation
+	}
+
+	t := s.currTx
+	for i, sp := range t.savepoints {
+		if sp.name != name {
+			continue
+		}
+
+		s.metrics.discardedOps += uint64(len(t.operations) - sp.index)
+		discarded := t.operations[sp.index:]
+		t.operations = t.operations[:sp.index]
+		t.index = nil
+		s.forgetDiscarded(discarded)
+		t.savepoints = t.savepoints[:i+1]
+
+		if t.touched != nil {
+			t.touched = make(map[string]bool)
+			for _, op := range t.operations {
+				if !op.isNote {
+					t.touched[op.key] = true
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrSavepointNotFound, name)
+}
+
+// savepoints returns the savepoints of the current transaction, one "name
+// index" per line, in the order of their index. It returns an empty string
+// if there is no current transaction.
+func (s *Store) savepoints() string {
+	lines := make([]string, len(s.currTx.savepoints))
+	for i, sp := range s.currTx.savepoints {
+		lines[i] = fmt.Sprintf("%s %d", sp.name, sp.index)
+	}
+
+	return strings.Join(lines, "\n")
+}
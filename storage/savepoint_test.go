@@ -0,0 +1,79 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+func TestSavepoints(t *testing.T) {
+	cases := []testCase{
+		{cmd: "savepoints", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "one", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "savepoints", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "start", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "1", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "two", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "2", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "three", val: "", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "again", val: "", want: "", wantErr: nil},
+		{cmd: "savepoints", key: "", val: "", want: "start 0\ntwo 2\nthree 3\nagain 3", wantErr: nil},
+		// redefining a savepoint moves it to the end
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "two", val: "", want: "", wantErr: nil},
+		{cmd: "savepoints", key: "", val: "", want: "start 0\nthree 3\nagain 3\ntwo 4", wantErr: nil},
+		// a nested transaction has its own savepoints
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "savepoints", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "savepoints", key: "", val: "", want: "", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestRollbackTo(t *testing.T) {
+	cases := []testCase{
+		{cmd: "rollbackto", key: "one", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "write", key: "a", val: "committed", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "rollbackto", key: "one", val: "", want: "", wantErr: storage.ErrSavepointNotFound},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "two", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "rollbackto", key: "two", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "2", wantErr: nil},
+		{cmd: "rollbackto", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "savepoints", key: "", val: "", want: "one 1", wantErr: nil},
+		{cmd: "rollbackto", key: "two", val: "", want: "", wantErr: storage.ErrSavepointNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "1", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestSavepointCompact(t *testing.T) {
+	cases := []testCase{
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "2", want: "", wantErr: nil},
+		{cmd: "savepoint", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "3", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "4", want: "", wantErr: nil},
+		// only the operations after the savepoint are compacted
+		{cmd: "compact", key: "", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "4", wantErr: nil},
+		{cmd: "rollbackto", key: "one", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "2", wantErr: nil},
+	}
+
+	test(t, cases)
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// lenHist returns the histogram of the byte lengths of the values of the
+// effective keyspace, one "min-max: count" per line. The buckets grow by
+// powers of ten, 0-9, 10-99, 100-999... up to the one of the longest value.
+func (s *Store) lenHist() string {
+	var counts []int
+	for _, v := range s.view() {
+		b := 0
+		for n := len(v); n >= 10; n /= 10 {
+			b++
+		}
+
+		for len(counts) <= b {
+			counts = append(counts, 0)
+		}
+		counts[b]++
+	}
+
+	lines := make([]string, len(counts))
+	lo, hi := 0, 9
+	for i, c := range counts {
+		lines[i] = fmt.Sprintf("%d-%d: %d", lo, hi, c)
+		lo, hi = hi+1, hi*10+9
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// keySize is a key and the byte length of its value.
+type keySize struct {
+	key  string
+	size int
+}
+
+// larger returns true if a goes before b in the top: a larger value or, for
+// the same size, a lower key.
+func (a keySize) larger(b keySize) bool {
+	if a.size != b.size {
+		return a.size > b.size
+	}
+
+	return a.key < b.key
+}
+
+// sizeHeap is a heap of keySizes with the smallest, in top order, first.
+type sizeHeap []keySize
+
+func (h sizeHeap) Len() int            { return len(h) }
+func (h sizeHeap) Less(i, j int) bool  { return h[j].larger(h[i]) }
+func (h sizeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sizeHeap) Push(x interface{}) { *h = append(*h, x.(keySize)) }
+func (h *sizeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// top returns the n keys of the effective keyspace with the largest values,
+// as "key=length" lines, from the largest. Keys with values of the same
+// length are sorted by key. Only n keys are kept while scanning.
+//
+// top returns ErrInvalidArgument if n is not a positive integer.
+func (s *Store) top(n string) (string, error) {
+	limit, err := IntArg("count", n, 1)
+	if err != nil {
+		return "", err
+	}
+
+	h := &sizeHeap{}
+	for k, v := range s.view() {
+		ks := keySize{key: k, size: len(v)}
+		if h.Len() < limit {
+			heap.Push(h, ks)
+		} else if ks.larger((*h)[0]) {
+			(*h)[0] = ks
+			heap.Fix(h, 0)
+		}
+	}
+
+	sizes := []keySize(*h)
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].larger(sizes[j]) })
+
+	lines := make([]string, len(sizes))
+	for i, ks := range sizes {
+		lines[i] = fmt.Sprintf("%s=%d", ks.key, ks.size)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
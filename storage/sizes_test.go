@@ -0,0 +1,48 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"strings"
+	"testing"
+)
+
+func TestLenHist(t *testing.T) {
+	cases := []testCase{
+		{cmd: "lenhist", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "123456789", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "1234567890", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: strings.Repeat("x", 1000), want: "", wantErr: nil},
+		{cmd: "lenhist", key: "", val: "", want: "0-9: 2\n10-99: 1\n100-999: 0\n1000-9999: 1", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "d", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "日本", want: "", wantErr: nil},
+		{cmd: "lenhist", key: "", val: "", want: "0-9: 3\n10-99: 1", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestTop(t *testing.T) {
+	cases := []testCase{
+		{cmd: "top", key: "3", val: "", want: "", wantErr: nil},
+		{cmd: "top", key: "0", val: "", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "top", key: "three", val: "", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "write", key: "a", val: "12", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "12345", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "123", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "12345", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "f", val: "123", want: "", wantErr: nil},
+		{cmd: "top", key: "1", val: "", want: "b=5", wantErr: nil},
+		{cmd: "top", key: "3", val: "", want: "b=5\nd=5\nc=3", wantErr: nil},
+		{cmd: "top", key: "4", val: "", want: "b=5\nd=5\nc=3\nf=3", wantErr: nil},
+		{cmd: "top", key: "10", val: "", want: "b=5\nd=5\nc=3\nf=3\na=2\ne=1", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "1234567", want: "", wantErr: nil},
+		{cmd: "top", key: "3", val: "", want: "e=7\nd=5\nc=3", wantErr: nil},
+	}
+
+	test(t, cases)
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// snapshotEntry is the representation of a committed key in a snapshot.
+type snapshotEntry struct {
+	Value string
+	Note  string
+
+	// ExpireAt is the expiration time in Unix nanoseconds. 0 means the key
+	// does not expire.
+	ExpireAt int64
+}
+
+// Snapshot writes the committed state of the Store to w, gob encoded. Open
+// transactions are not part of the snapshot, nor are expired keys.
+func (s *Store) Snapshot(w io.Writer) error {
+	now := s.now()
+	entries := make(map[string]snapshotEntry, len(s.kv))
+	for k, e := range s.kv {
+		if e.expired(now) {
+			continue
+		}
+
+		se := snapshotEntry{Value: e.value, Note: s.notes[k]}
+		if !e.expireAt.IsZero() {
+			se.ExpireAt = e.expireAt.UnixNano()
+		}
+
+		entries[k] = se
+	}
+
+	return gob.NewEncoder(w).Encode(entries)
+}
+
+// Restore returns a new Store with the committed state of the snapshot read
+// from r.
+func Restore(r io.Reader) (*Store, error) {
+	s := NewStore()
+	if err := s.load(r); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// readSnapshot returns the committed state in the snapshot read from r.
+func readSnapshot(r io.Reader) (checkpoint, error) {
+	var entries map[string]snapshotEntry
+	if err := gob.NewDecoder(r).Decode(&entries); err != nil {
+		return checkpoint{}, fmt.Errorf("snapshot: %w", err)
+	}
+
+	c := checkpoint{kv: make(kvStore, len(entries)), notes: make(map[string]string)}
+	for k, se := range entries {
+		e := entry{value: se.Value}
+		if se.ExpireAt != 0 {
+			e.expireAt = time.Unix(0, se.ExpireAt)
+		}
+
+		c.kv[k] = e
+		if se.Note != "" {
+			c.notes[k] = se.Note
+		}
+	}
+
+	return c, nil
+}
+
+// load replaces the committed state of the Store with the snapshot read from
+// r. All open transactions are discarded.
+func (s *Store) load(r io.Reader) error {
+	c, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+
+	s.kv = c.kv
+	s.notes = c.notes
+	s.currTx = &tx{}
+	s.rebuildBloom()
+	s.rebuildLRU()
+	s.recordRestore()
+	return nil
+}
+
+// MergeFile writes the keys of the snapshot in the file at path to the
+// committed state, with their notes and expiration. Unlike the restore
+// command, the existing keys are kept, unless the snapshot has them: then
+// they are overwritten. Open transactions are kept, and see the merged keys
+// as committed.
+func (s *Store) MergeFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c, err := readSnapshot(f)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(c.kv))
+	for k := range c.kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		e := c.kv[k]
+		if err := s.apply(operation{key: k, value: e.value, isWrite: true, expireAt: e.expireAt}); err != nil {
+			return err
+		}
+
+		if note, ok := c.notes[k]; ok {
+			if err := s.apply(operation{key: k, value: note, isWrite: true, isNote: true}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Save writes a snapshot of the Store to the file at path. An existing file at
+// path is kept as a backup at path.bak, replacing any previous backup.
+//
+// The snapshot is written and synced to path.tmp first: the file at path is
+// only replaced by a complete snapshot, and is left as it was on error.
+func (s *Store) Save(path string) error {
+	tmp := path + ".tmp"
+	if err := s.writeSnapshotFile(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Rename(path, path+".bak"); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// writeSnapshotFile writes a snapshot of the Store to the file at path, and
+// syncs it to disk.
+func (s *Store) writeSnapshotFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// restoreFile replaces the committed state of the Store with the snapshot in
+// the file at path. All open transactions are discarded. If the AOF is
+// enabled, it is rewritten with the restored state.
+func (s *Store) restoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := s.load(f); err != nil {
+		return err
+	}
+
+	if s.aof == nil {
+		return nil
+	}
+
+	return s.rewriteAOF()
+}
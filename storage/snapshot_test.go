@@ -0,0 +1,142 @@
+package storage_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// snapshotKeys are keys with characters that need care when serialized.
+var snapshotKeys = []string{"a", "with space", "line\nbreak", "quote\"", "ünïcödé", "", "tab\t"}
+
+func TestSnapshotRestore(t *testing.T) {
+	store := storage.NewStore()
+	for i, k := range snapshotKeys {
+		if _, err := store.Process("write", k, k+string(rune('0'+i))); err != nil {
+			t.Fatalf("\nGot Error '%s' want 'nil'", err)
+		}
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "write", key: "removed", val: "hi", want: "", wantErr: nil},
+		{cmd: "remove", key: "removed", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "open", val: "hi", want: "", wantErr: nil},
+	})
+
+	var buf bytes.Buffer
+	if err := store.Snapshot(&buf); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	restored, err := storage.Restore(&buf)
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	for i, k := range snapshotKeys {
+		testStore(t, restored, []testCase{
+			{cmd: "read", key: k, val: "", want: k + string(rune('0'+i)), wantErr: nil},
+		})
+	}
+
+	testStore(t, restored, []testCase{
+		{cmd: "note", key: "a", val: "", want: "note", wantErr: nil},
+		{cmd: "read", key: "removed", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "open", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestSnapshotRestoreCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.snapshot")
+
+	cases := []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "snapshot", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "bye", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "bye", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "restore", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	}
+
+	test(t, cases)
+}
+
+func TestSaveBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.snapshot")
+
+	test(t, []testCase{
+		{cmd: "write", key: "a", val: "first", want: "", wantErr: nil},
+		{cmd: "snapshot", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "second", want: "", wantErr: nil},
+		{cmd: "snapshot", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "restore", key: path + ".bak", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "first", wantErr: nil},
+		{cmd: "restore", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "second", wantErr: nil},
+	})
+}
+
+func TestSaveErrorKeepsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.snapshot")
+
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "first", want: "", wantErr: nil},
+		{cmd: "snapshot", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "second", want: "", wantErr: nil},
+	})
+
+	// the temporary file can not be created
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Process("snapshot", path); err == nil {
+		t.Fatalf("\nGot Error 'nil' want an error")
+	}
+
+	if _, err := os.Stat(path + ".bak"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("\nGot Error '%v' want '%v' for the backup", err, fs.ErrNotExist)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "restore", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "first", wantErr: nil},
+	})
+}
+
+func TestMergeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "other.snapshot")
+
+	test(t, []testCase{
+		{cmd: "write", key: "b", val: "other b", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "other c", want: "", wantErr: nil},
+		{cmd: "annotate", key: "c", val: "other note", want: "", wantErr: nil},
+		{cmd: "snapshot", key: path, val: "", want: "", wantErr: nil},
+	})
+
+	test(t, []testCase{
+		{cmd: "mergefile", key: path + ".missing", val: "", want: "", wantErr: fs.ErrNotExist},
+		{cmd: "write", key: "a", val: "mine a", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "mine b", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "open d", want: "", wantErr: nil},
+		{cmd: "mergefile", key: path, val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "open d", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "mine a", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "other b", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "other c", wantErr: nil},
+		{cmd: "note", key: "c", val: "", want: "other note", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSONFlag makes the stats command render the statistics as a JSON object.
+const JSONFlag = "--json"
+
+// stats are the statistics of a Store at a point in time.
+type stats struct {
+	Depth             int               `json:"depth"`
+	Keys              int               `json:"keys"`
+	PendingOperations int               `json:"pending_operations"`
+	Counters          map[string]uint64 `json:"counters"`
+}
+
+// stats returns the statistics of the Store: the number of open transactions,
+// of committed keys, of operations pending in the transactions and the
+// counters of the metrics.
+func (s *Store) stats() stats {
+	st := stats{Depth: s.depth(), Counters: make(map[string]uint64)}
+
+	now := s.now()
+	for _, e := range s.kv {
+		if !e.expired(now) {
+			st.Keys++
+		}
+	}
+
+	for _, t := range s.levels() {
+		st.PendingOperations += len(t.operations)
+	}
+
+	for _, c := range s.metrics.counters() {
+		st.Counters[c.name] = c.value
+	}
+
+	return st
+}
+
+// statsJSON returns the statistics of the Store as a JSON object.
+func (s *Store) statsJSON() (string, error) {
+	b, err := json.Marshal(s.stats())
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// processStats renders the statistics of the Store, one "name: value" per
+// line, or as JSON if the flag is JSONFlag.
+//
+// processStats returns error if the flag is not empty or JSONFlag.
+func (s *Store) processStats(flag string) (string, error) {
+	switch flag {
+	case "":
+		st := s.stats()
+		lines := []string{
+			fmt.Sprintf("depth: %d", st.Depth),
+			fmt.Sprintf("keys: %d", st.Keys),
+			fmt.Sprintf("pending_operations: %d", st.PendingOperations),
+			s.metrics.render(),
+		}
+
+		return strings.Join(lines, "\n"), nil
+	case JSONFlag:
+		return s.statsJSON()
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrInvalidFlag, flag)
+}
@@ -0,0 +1,73 @@
+package storage_test
+
+import (
+	"encoding/json"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"reflect"
+	"testing"
+)
+
+// statsCases leave the Store with 2 committed keys and 2 open transactions
+// with 3 pending operations.
+var statsCases = []testCase{
+	{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+	{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+	{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+	{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+	{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+	{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+	{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+	{cmd: "write", key: "d", val: "hi", want: "", wantErr: nil},
+}
+
+func TestStats(t *testing.T) {
+	store := storage.NewStore()
+	testStore(t, store, statsCases)
+	testStore(t, store, []testCase{
+		{cmd: "stats", key: "", val: "", want: "depth: 2\n" +
+			"keys: 2\n" +
+			"pending_operations: 3\n" +
+			"reads: 1\n" +
+			"writes: 4\n" +
+			"removes: 1\n" +
+			"commits: 0\n" +
+			"discards: 0\n" +
+			"applied_operations: 2\n" +
+			"discarded_operations: 0", wantErr: nil},
+		{cmd: "stats", key: "--prom", val: "", want: "", wantErr: storage.ErrInvalidFlag},
+	})
+}
+
+func TestStatsJSON(t *testing.T) {
+	store := storage.NewStore()
+	testStore(t, store, statsCases)
+
+	out, err := store.Process("stats", "--json")
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("\nGot invalid JSON '%s': %s", out, err)
+	}
+
+	want := map[string]interface{}{
+		"depth":              2.0,
+		"keys":               2.0,
+		"pending_operations": 3.0,
+		"counters": map[string]interface{}{
+			"reads":                1.0,
+			"writes":               4.0,
+			"removes":              1.0,
+			"commits":              0.0,
+			"discards":             0.0,
+			"applied_operations":   2.0,
+			"discarded_operations": 0.0,
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\nGot '%v' want '%v'", got, want)
+	}
+}
@@ -3,34 +3,140 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	// Supported commands
-	Write   = "write"
-	Read    = "read"
-	Remove  = "remove"
-	Begin   = "begin"
-	Commit  = "commit"
-	Discard = "discard"
+	Write    = "write"
+	Read     = "read"
+	Remove   = "remove"
+	Begin    = "begin"
+	Commit   = "commit"
+	Discard  = "discard"
+	TxKeys   = "txkeys"
+	SetEx    = "setex"
+	GetDel   = "getdel"
+	Annotate = "annotate"
+	Note     = "note"
+
+	// File commands
+	SnapshotFile = "snapshot"
+	RestoreFile  = "restore"
+	RewriteAOF   = "bgrewriteaof"
+	AOF          = "aof"
+
+	CommitCost = "commitcost"
+	Check      = "check"
+	Metrics    = "metrics"
+	KeyHistory = "keyhistory"
+	ResetTx    = "resettx"
+
+	Checkpoint        = "checkpoint"
+	RestoreCheckpoint = "restorecheckpoint"
+
+	Tree      = "tree"
+	MergeFile = "mergefile"
+	List      = "list"
+	Dirty     = "dirty"
+	Compact   = "compact"
+	ReadAll   = "readall"
+	Eq        = "eq"
+	Assert    = "assert"
+	Grep      = "grep"
+
+	RenamePrefix = "renameprefix"
+	CopyPrefix   = "copyprefix"
+	Flatten      = "flatten"
+	MGetPrefix   = "mgetprefix"
+	CommitTiming = "committiming"
+	Verify       = "verify"
+	StoreHash    = "storehash"
+
+	Savepoint  = "savepoint"
+	RollbackTo = "rollbackto"
+	Savepoints = "savepoints"
+
+	TxSizes    = "txsizes"
+	AutoCommit = "autocommit"
+	Stats      = "stats"
+
+	Truncate = "truncate"
+	Replace  = "replace"
+	Reverse  = "reverse"
+	Upper    = "upper"
+	Lower    = "lower"
+	Inspect  = "inspect"
+
+	WriteEnv     = "writeenv"
+	ExportPrefix = "exportprefix"
+	CountValues  = "countvalues"
+	LenHist      = "lenhist"
+	Top          = "top"
+	ImportJSON   = "importjson"
+	ExportJSON   = "exportjson"
+	DiffFiles    = "difffiles"
+	Patch        = "patch"
+	Flush        = "flush"
+	Explain      = "explain"
+	ReadAt       = "readat"
+	LastSeq      = "lastseq"
+	SortByValue  = "sortbyvalue"
+	ExportLog    = "exportlog"
+	ImportLog    = "importlog"
+
+	DeleteMatching = "deletematching"
+	WriteHex       = "writehex"
+	ReadHex        = "readhex"
+	WriteB64       = "writeb64"
+	ReadB64        = "readb64"
+	Info           = "info"
 )
 
 var (
 	ErrNoCurrentTransation error = errors.New("There is no current transaction to commit")
 	ErrKeyNotFound         error = errors.New("Key not found")
 	ErrUnsupportedCommand  error = errors.New("Unsupported command")
+	ErrInvalidArgument     error = errors.New("Invalid argument")
+	ErrNoTransaction       error = errors.New("Mutations require a transaction")
+	ErrDuplicateKeyInTx    error = errors.New("Key already modified in the transaction")
+	ErrAssertionFailed     error = errors.New("Assertion failed")
+	ErrEnvNotSet           error = errors.New("Environment variable not set")
+	ErrMaxKeysExceeded     error = errors.New("Maximum number of keys exceeded")
 )
 
 // operation represents a unit of a transaction. An operation modifies
 // eventually the state of the kv. operations are appended to the transaction
 // or written in the kv sequencially. An operation can only modify the state of
 // the kv by writing (isWrite = true) or removing (isWrite = false).
+//
+// A write can expire: the key is gone at the time expireAt. The zero time
+// means the key does not expire.
+//
+// A write with isNote = true writes the note of the key instead of its value.
+// A remove removes both the value and the note of the key.
 type operation struct {
-	key     string
-	value   string
-	isWrite bool
+	key      string
+	value    string
+	isWrite  bool
+	expireAt time.Time
+	isNote   bool
+}
+
+// expired returns true if the operation op is an expiring write and the time
+// now is past its expiration.
+func (op operation) expired(now time.Time) bool {
+	return !op.expireAt.IsZero() && !now.Before(op.expireAt)
 }
 
 // tx represents a transaction. A transaction has a parent transaction. All
@@ -39,6 +145,25 @@ type operation struct {
 type tx struct {
 	parent     *tx
 	operations []operation
+
+	// compactAt is the number of operations that triggers the next eager
+	// compaction, if enabled.
+	compactAt int
+
+	// touched are the keys written or removed in the transaction. Only kept
+	// if shadowing is disallowed.
+	touched map[string]bool
+
+	// savepoints are the savepoints of the transaction, in the order they
+	// were defined, which is also the order of their index.
+	savepoints []savepoint
+
+	// index is the position in operations of the last write or remove of
+	// each key, so reads resolve a key in a single lookup per transaction. A
+	// remove is resolved as any write: its operation is the tombstone. Built
+	// on the first lookup, and dropped when the operations are rewritten. nil
+	// if not built.
+	index map[string]int
 }
 
 // isRoot returns true if the transaction tx has no parent.
@@ -59,18 +184,112 @@ func (t *tx) hasOperations() bool {
 	return false
 }
 
+// add appends the operation op to the operations of the transaction t.
+func (t *tx) add(op operation) {
+	t.operations = append(t.operations, op)
+	if t.index != nil && !op.isNote {
+		t.index[op.key] = len(t.operations) - 1
+	}
+}
+
+// buildIndex builds the index of the transaction t, if not built.
+func (t *tx) buildIndex() {
+	if t.index != nil {
+		return
+	}
+
+	t.index = make(map[string]int)
+	for i, op := range t.operations {
+		if !op.isNote {
+			t.index[op.key] = i
+		}
+	}
+}
+
+// numKeys returns the number of keys written or removed in the transaction t.
+func (t *tx) numKeys() int {
+	t.buildIndex()
+	return len(t.index)
+}
+
+// lookup returns the last write or remove of the key key in the transaction
+// t, and false if there is none. Notes are not returned.
+func (t *tx) lookup(key string) (operation, bool) {
+	t.buildIndex()
+	i, ok := t.index[key]
+	if !ok {
+		return operation{}, false
+	}
+
+	return t.operations[i], true
+}
+
+// compact returns the operations ops without the ones shadowed by a later
+// operation on the same key. Applying the compacted operations results in the
+// same state as applying ops. The order of the operations is kept.
+//
+// For each key only the operations from its last remove on matter: the remove
+// itself, that clears the value and the note, the last write of the value and
+// the last write of the note.
+func compact(ops []operation) []operation {
+	type last struct {
+		remove, write, note int
+	}
+
+	lasts := make(map[string]*last)
+	for i, op := range ops {
+		l, ok := lasts[op.key]
+		if !ok {
+			l = &last{remove: -1, write: -1, note: -1}
+			lasts[op.key] = l
+		}
+
+		switch {
+		case !op.isWrite:
+			*l = last{remove: i, write: -1, note: -1}
+		case op.isNote:
+			l.note = i
+		default:
+			l.write = i
+		}
+	}
+
+	compacted := make([]operation, 0, len(lasts))
+	for i, op := range ops {
+		l := lasts[op.key]
+		if i == l.remove || i == l.write || i == l.note {
+			compacted = append(compacted, op)
+		}
+	}
+
+	return compacted
+}
+
+// entry represents a value in the kvStore and its expiration time. The zero
+// time means the value does not expire.
+type entry struct {
+	value    string
+	expireAt time.Time
+}
+
+// expired returns true if the entry e expires and the time now is past its
+// expiration.
+func (e entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
 // kvStore represents a in-memory Key Value storage system.
 //
 // As this is just a barebones kv Store for one client, there is no need for
 // locking or multiple threads.
-type kvStore map[string]string
+type kvStore map[string]entry
 
 // modify applies an operation to the kvStore. Depending on the isWrite flag
 // of the operation op, modify writes or removes to the kvStore.
 func (kv kvStore) modify(op operation) {
 	switch op.isWrite {
 	case true:
-		kv[op.key] = op.value
+		kv[op.key] = entry{value: op.value, expireAt: op.expireAt}
 	case false:
 		delete(kv, op.key)
 	}
@@ -82,19 +301,218 @@ func (kv kvStore) modify(op operation) {
 type Store struct {
 	kv     kvStore
 	currTx *tx
+
+	// notes are the committed notes of the keys, parallel to kv.
+	notes map[string]string
+
+	// logger receives the lifecycle events.
+	logger Logger
+
+	// now returns the current time. Used for the expiration of keys.
+	now func() time.Time
+
+	// lookupEnv returns the value of an environment variable, and whether it
+	// is set.
+	lookupEnv func(string) (string, bool)
+
+	// txRequired rejects mutations outside a transaction.
+	txRequired bool
+
+	// noShadowing rejects a second write or remove of a key in the same
+	// transaction.
+	noShadowing bool
+
+	// lenientRemove makes the remove of a missing key a no-op.
+	lenientRemove bool
+
+	// normalizeKeys trims and collapses the whitespace of the keys.
+	normalizeKeys bool
+
+	// maxKeys is the maximum number of keys of the effective keyspace. 0
+	// means unlimited.
+	maxKeys int
+
+	// lru orders the keys by recency of access, to evict the least recently
+	// used one over maxKeys. nil if not enabled.
+	lru *lru
+
+	// noAutoCommit buffers the mutations at the root in an implicit
+	// transaction, instead of writing them to the kvStore.
+	noAutoCommit bool
+
+	// metrics count the keyspace events.
+	metrics metrics
+
+	// startedAt is the creation time of the Store, by its clock.
+	startedAt time.Time
+
+	// commands is the number of commands processed, failed or not.
+	commands uint64
+
+	// checkpoints are named copies of the committed state.
+	checkpoints map[string]checkpoint
+
+	// separator separates the levels of hierarchical keys.
+	separator string
+
+	// flushThreshold is the number of operations of a transaction over which
+	// they are eagerly compacted. 0 disables the eager compaction.
+	flushThreshold int
+
+	// aof appends the committed operations to the append-only file. nil if
+	// the AOF is not enabled.
+	aof *aofWriter
+
+	// aofPaused stops the appending to the AOF until resumed.
+	aofPaused bool
+
+	// bloom holds the keys ever written, to answer the reads of missing keys
+	// early. nil if not enabled.
+	bloom *bloomFilter
+
+	// audit records the operations applied to the kvStore. nil if not
+	// enabled.
+	audit *auditLog
+}
+
+// Option configures a Store on creation.
+type Option func(*Store)
+
+// WithDebug makes the Store log every transaction transition (begin, commit
+// and discard) to w, together with the resulting depth and number of
+// operations of the current transaction. It is a Logger writing the debug
+// events to w: it replaces the Logger of WithLogger, and the other way round.
+func WithDebug(w io.Writer) Option {
+	return WithLogger(writerLogger{w: w})
+}
+
+// WithClock makes the Store use now instead of time.Now as the source of the
+// current time.
+func WithClock(now func() time.Time) Option {
+	return func(s *Store) {
+		s.now = now
+	}
+}
+
+// WithLookupEnv makes the Store use lookup instead of os.LookupEnv to read
+// the environment variables.
+func WithLookupEnv(lookup func(string) (string, bool)) Option {
+	return func(s *Store) {
+		s.lookupEnv = lookup
+	}
 }
 
-// Process processes a command.
+// WithTxRequired makes the Store reject the mutations (write, remove...) when
+// there is no open transaction, instead of writing them directly to the
+// kvStore. Reads are not affected.
+func WithTxRequired() Option {
+	return func(s *Store) {
+		s.txRequired = true
+	}
+}
+
+// WithNoShadowing makes the Store reject a write or remove of a key already
+// written or removed in the current transaction, with ErrDuplicateKeyInTx,
+// to catch accidental double writes. Notes are not affected, nor are the
+// keys modified in an outer transaction.
+func WithNoShadowing() Option {
+	return func(s *Store) {
+		s.noShadowing = true
+	}
+}
+
+// WithLenientRemove makes the remove of a missing key succeed without effect,
+// instead of returning ErrKeyNotFound.
+func WithLenientRemove() Option {
+	return func(s *Store) {
+		s.lenientRemove = true
+	}
+}
+
+// WithMaxKeys makes the Store reject the write of a new key, with
+// ErrMaxKeysExceeded, when the effective keyspace already has n keys. The
+// keys removed, committed or not, free capacity. Overwriting an existing key
+// is always allowed.
+func WithMaxKeys(n int) Option {
+	return func(s *Store) {
+		s.maxKeys = n
+	}
+}
+
+// WithFlushThreshold makes the Store eagerly compact the operations of a
+// transaction once their number exceeds n, instead of keeping all of them
+// until the commit. This reduces the peak memory of large or deeply nested
+// transactions.
+//
+// The operations are not flushed to the kvStore, as the outer transactions
+// could still be discarded: the observable semantics do not change.
+func WithFlushThreshold(n int) Option {
+	return func(s *Store) {
+		s.flushThreshold = n
+	}
+}
+
+// WithSeparator makes the Store use sep as the separator of the levels of
+// hierarchical keys, instead of ":". An empty sep keeps the default.
+func WithSeparator(sep string) Option {
+	return func(s *Store) {
+		if sep != "" {
+			s.separator = sep
+		}
+	}
+}
+
+// arg returns the argument i of args, or an empty string if there is none.
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+
+	return ""
+}
+
+// IntArg parses the numeric argument token of a command. name describes the
+// argument in the error.
+//
+// IntArg returns ErrInvalidArgument if token is not an integer, or if it is
+// lower than min.
+func IntArg(name, token string, min int) (int, error) {
+	n, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s %s (integer required)", ErrInvalidArgument, name, token)
+	}
+
+	if n < min {
+		return 0, fmt.Errorf("%w: %s %s (minimum %d)", ErrInvalidArgument, name, token, min)
+	}
+
+	return n, nil
+}
+
+// Process processes a command with its arguments args. Commands on a key take
+// the key as first argument.
 //
 // It returns an error if the Store does not support the command.
 // It also returns an error if the Store rejects the command.
-func (s *Store) Process(command, key, value string) (string, error) {
+func (s *Store) Process(command string, args ...string) (string, error) {
+	s.commands++
+	v, err := s.process(command, args...)
+	if err != nil && s.logging() {
+		s.logger.Errorf("%s: %v", command, err)
+	}
+
+	return v, err
+}
+
+// process runs the command of Process.
+func (s *Store) process(command string, args ...string) (string, error) {
+	key, value := arg(args, 0), arg(args, 1)
 
 	switch command {
 	case Write:
-		s.write(key, value)
-		return "", nil
+		return "", s.write(key, value)
 	case Read:
+		s.metrics.reads++
 		return s.read(key)
 	case Remove:
 		return "", s.remove(key)
@@ -106,6 +524,200 @@ func (s *Store) Process(command, key, value string) (string, error) {
 		return "", nil
 	case Commit:
 		return "", s.commit()
+	case TxKeys:
+		return s.txKeys(), nil
+	case SetEx:
+		return "", s.setEx(key, value, arg(args, 2))
+	case GetDel:
+		return s.getDel(key)
+	case Annotate:
+		return "", s.annotate(key, value)
+	case Note:
+		return s.note(key)
+	case SnapshotFile:
+		return "", s.Save(key)
+	case RestoreFile:
+		return "", s.restoreFile(key)
+	case RewriteAOF:
+		return "", s.rewriteAOF()
+	case AOF:
+		return "", s.setAOF(key)
+	case CommitCost:
+		return s.commitCost()
+	case Check:
+		return s.integrityCheck(), nil
+	case Metrics:
+		return s.processMetrics(key)
+	case KeyHistory:
+		return s.keyHistory(key), nil
+	case ResetTx:
+		return strconv.Itoa(s.resetTx()), nil
+	case Checkpoint:
+		s.checkpoint(key)
+		return "", nil
+	case RestoreCheckpoint:
+		return "", s.restoreCheckpoint(key)
+	case Tree:
+		return s.tree(), nil
+	case MergeFile:
+		return "", s.MergeFile(key)
+	case List:
+		return s.list(args)
+	case Dirty:
+		return strconv.FormatBool(s.dirty()), nil
+	case Compact:
+		return s.compactTx()
+	case ReadAll:
+		return s.readAll()
+	case Eq:
+		return strconv.FormatBool(s.eq(key, value)), nil
+	case Assert:
+		return "", s.assert(key, value)
+	case Grep:
+		return s.grep(key)
+	case Verify:
+		ok, err := s.verify(key, value)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.FormatBool(ok), nil
+	case Savepoint:
+		return "", s.savepoint(key)
+	case RollbackTo:
+		return "", s.rollbackTo(key)
+	case Savepoints:
+		return s.savepoints(), nil
+	case Reverse:
+		return s.transform(key, reverseRunes)
+	case Top:
+		return s.top(key)
+	case LenHist:
+		return s.lenHist(), nil
+	case CountValues:
+		return strconv.Itoa(s.countValues()), nil
+	case ExportPrefix:
+		n, err := s.exportPrefix(key, value)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
+	case ImportJSON:
+		n, err := s.importJSON(key)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
+	case ExportJSON:
+		return "", s.exportJSON(key)
+	case DiffFiles:
+		return diffFiles(key, value)
+	case Patch:
+		n, err := s.applyPatch(key)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
+	case Explain:
+		return s.explain(key)
+	case ReadAt:
+		seq, err := IntArg("seq", value, 0)
+		if err != nil {
+			return "", err
+		}
+
+		return s.readAt(key, seq)
+	case DeleteMatching:
+		n, err := s.deleteMatching(key)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
+	case SortByValue:
+		return s.sortByValue(), nil
+	case ExportLog:
+		n, err := s.exportLog(key)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
+	case ImportLog:
+		n, err := s.importLog(key)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
+	case LastSeq:
+		seq, err := s.lastSeq()
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(seq), nil
+	case Flush:
+		n, err := s.flush()
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
+	case WriteEnv:
+		return "", s.writeEnv(key, value)
+	case Inspect:
+		return s.inspect(key)
+	case Upper:
+		return s.transform(key, strings.ToUpper)
+	case Lower:
+		return s.transform(key, strings.ToLower)
+	case Replace:
+		return s.replace(key, value, arg(args, 2))
+	case Truncate:
+		return s.truncate(key, value)
+	case Stats:
+		return s.processStats(key)
+	case AutoCommit:
+		return "", s.setAutoCommit(key)
+	case TxSizes:
+		return s.txSizes(), nil
+	case StoreHash:
+		return s.StoreHash(), nil
+	case CommitTiming:
+		return s.metrics.commitTiming(), nil
+	case MGetPrefix:
+		return s.mgetPrefix(key)
+	case Flatten:
+		s.flatten()
+		return "", nil
+	case RenamePrefix:
+		n, err := s.renamePrefix(key, value)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
+	case WriteHex:
+		return "", s.writeHex(key, value)
+	case ReadHex:
+		return s.readHex(key)
+	case WriteB64:
+		return "", s.writeB64(key, value)
+	case ReadB64:
+		return s.readB64(key)
+	case Info:
+		return s.info(), nil
+	case CopyPrefix:
+		n, err := s.copyPrefix(key, value)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(n), nil
 	}
 
 	return "", fmt.Errorf("%w: %s", ErrUnsupportedCommand, command)
@@ -113,25 +725,208 @@ func (s *Store) Process(command, key, value string) (string, error) {
 
 // modify applies the operation op to the Store. modify either writes to the
 // kvStore or appends the operation to the current transaction.
-func (s *Store) modify(op operation) {
+//
+// modify returns error if the operation can not be persisted, if a
+// transaction is required and there is none, if the write of a new key
+// exceeds the maximum number of keys, or if shadowing is disallowed and the
+// transaction already modified the key.
+func (s *Store) modify(op operation) error {
+	op.key = s.normalize(op.key)
+	if err := s.checkTxRequired(); err != nil {
+		return err
+	}
+
+	// every rejection is checked before evicting: an eviction is not undone.
+	shadowed := s.noShadowing && !op.isNote && !s.currTx.isRoot()
+	if shadowed && s.currTx.touched[op.key] {
+		return fmt.Errorf("%w: %s", ErrDuplicateKeyInTx, op.key)
+	}
+
+	if s.exceedsMaxKeys(op) {
+		evicted, err := s.evictLRU()
+		if err != nil {
+			return err
+		}
+
+		if !evicted {
+			return fmt.Errorf("%w: %s", ErrMaxKeysExceeded, op.key)
+		}
+	}
+
+	// the implicit transaction is committed or discarded as any other.
+	if s.currTx.isRoot() && s.noAutoCommit {
+		s.begin()
+	}
+
 	if s.currTx.isRoot() {
 		//write db
-		s.kv.modify(op)
-	} else {
-		// append to transaction operations
-		s.currTx.operations = append(s.currTx.operations, op)
+		s.touch(op.key)
+		return s.apply(op)
+	}
+
+	if shadowed {
+		if s.currTx.touched == nil {
+			s.currTx.touched = make(map[string]bool)
+		}
+		s.currTx.touched[op.key] = true
 	}
+
+	// append to transaction operations
+	s.touch(op.key)
+	s.addBloom(op)
+	s.currTx.add(op)
+	s.maybeCompact(s.currTx)
+	return nil
 }
 
-// NewStore returns a Store.
-func NewStore() *Store {
-	return &Store{kv: make(map[string]string), currTx: &tx{}}
+// checkTxRequired returns ErrNoTransaction if transactions are required for
+// mutations and there is no current transaction. The commands mutating in
+// their own Atomic transaction check it first, as modify sees that one.
+func (s *Store) checkTxRequired() error {
+	if s.currTx.isRoot() && s.txRequired {
+		return ErrNoTransaction
+	}
+
+	return nil
+}
+
+// exceedsMaxKeys returns true if the operation op writes a new key to an
+// effective keyspace already at the maximum number of keys.
+//
+// The key is looked up as read does, in O(depth). The committed keys plus the
+// keys of each transaction bound the size of the keyspace: the keyspace is
+// only counted when the bound reaches the maximum, as the expired keys are
+// still in the kvStore.
+func (s *Store) exceedsMaxKeys(op operation) bool {
+	if s.maxKeys <= 0 || !op.isWrite || op.isNote {
+		return false
+	}
+
+	if _, ok := s.lookupEntry(op.key); ok {
+		return false
+	}
+
+	bound := len(s.kv)
+	for t := s.currTx; !t.isRoot(); t = t.parent {
+		bound += t.numKeys()
+	}
+
+	if bound < s.maxKeys {
+		return false
+	}
+
+	return len(s.view()) >= s.maxKeys
+}
+
+// setAutoCommit turns the autocommit on or off. With autocommit off, the
+// first mutation at the root begins an implicit transaction, so the root
+// mutations only persist with an explicit commit, and can be discarded.
+// Turning it on again does not commit an open implicit transaction.
+//
+// setAutoCommit returns ErrInvalidArgument if value is not on or off.
+func (s *Store) setAutoCommit(value string) error {
+	switch value {
+	case "on":
+		s.noAutoCommit = false
+	case "off":
+		s.noAutoCommit = true
+	default:
+		return fmt.Errorf("%w: autocommit %s (on|off)", ErrInvalidArgument, value)
+	}
+
+	return nil
+}
+
+// maybeCompact compacts the operations of the transaction t if they exceed
+// the flush threshold. If the compacted operations still exceed half of the
+// next trigger, the trigger doubles, so a transaction of distinct keys is not
+// compacted on every operation.
+func (s *Store) maybeCompact(t *tx) {
+	if s.flushThreshold <= 0 {
+		return
+	}
+
+	if t.compactAt < s.flushThreshold {
+		t.compactAt = s.flushThreshold
+	}
+
+	if len(t.operations) <= t.compactAt {
+		return
+	}
+
+	t.compactOperations()
+	if 2*len(t.operations) > t.compactAt {
+		t.compactAt = 2 * len(t.operations)
+	}
+}
+
+// NewStore returns a Store configured with the options opts.
+func NewStore(opts ...Option) *Store {
+	s := &Store{
+		kv:        make(kvStore),
+		notes:     make(map[string]string),
+		currTx:    &tx{},
+		now:       time.Now,
+		lookupEnv: os.LookupEnv,
+		separator: defaultSeparator,
+		logger:    nopLogger{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.startedAt = s.now()
+	return s
+}
+
+// depth returns the number of open transactions.
+func (s *Store) depth() int {
+	d := 0
+	for t := s.currTx; !t.isRoot(); t = t.parent {
+		d++
+	}
+
+	return d
+}
+
+// levels returns the open transactions, from the outermost, level 1, to the
+// current one. The root is level 0 and not part of the result.
+func (s *Store) levels() []*tx {
+	var levels []*tx
+	for t := s.currTx; !t.isRoot(); t = t.parent {
+		levels = append(levels, t)
+	}
+
+	for i, j := 0, len(levels)-1; i < j; i, j = i+1, j-1 {
+		levels[i], levels[j] = levels[j], levels[i]
+	}
+
+	return levels
+}
+
+// logTx logs the transition event to the Logger. Without a Logger, the depth
+// is not even computed.
+func (s *Store) logTx(event string) {
+	if !s.logging() {
+		return
+	}
+
+	s.logger.Debugf("%s: depth=%d ops=%d", event, s.depth(), len(s.currTx.operations))
 }
 
 // write writes the value and the key to the Store. Depending of the current
 // transaction, it writes to the kvStore or the to current transation.
-func (s *Store) write(key, value string) {
-	s.modify(operation{key: key, value: value, isWrite: true})
+func (s *Store) write(key, value string) error {
+	s.metrics.writes++
+	return s.modify(operation{key: key, value: value, isWrite: true})
+}
+
+// writeEntry writes the entry e to the key, like write, keeping the
+// expiration of e.
+func (s *Store) writeEntry(key string, e entry) error {
+	s.metrics.writes++
+	return s.modify(operation{key: key, value: e.value, isWrite: true, expireAt: e.expireAt})
 }
 
 // read retrieves the current value of the key key. The value can be on the
@@ -139,46 +934,163 @@ func (s *Store) write(key, value string) {
 //
 // read returns error if the key does not exist.
 func (s *Store) read(key string) (string, error) {
+	e, err := s.readEntry(key)
+	if err != nil {
+		return "", err
+	}
+
+	return e.value, nil
+}
+
+// readEntry retrieves the current entry of the key key: its value and its
+// expiration. Like read, it counts as an access to the key.
+//
+// readEntry returns error if the key does not exist.
+func (s *Store) readEntry(key string) (entry, error) {
+	key = s.normalize(key)
+	e, ok := s.lookupEntry(key)
+	if !ok {
+		return entry{}, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	s.touch(key)
+	return e, nil
+}
+
+// lookupEntry returns the current entry of the key key, and false if the key
+// does not exist. Unlike readEntry, it is not an access to the key.
+func (s *Store) lookupEntry(key string) (entry, bool) {
+	// a key never written is not in the transactions nor in the kv.
+	if s.bloom != nil && !s.bloom.mayContain(key) {
+		return entry{}, false
+	}
+
 	currentTx := s.currTx
 	for !currentTx.isRoot() {
-		// search for the key recursively and in reverse
-		for i := len(s.currTx.operations) - 1; i >= 0; i-- {
-			if key == s.currTx.operations[i].key {
-
-				// false means key was deleted in the transaction
-				if false == s.currTx.operations[i].isWrite {
-					return "", fmt.Errorf("%w: %s", ErrKeyNotFound, key)
-				}
+		// search for the key recursively, from the current transaction
+		if op, ok := currentTx.lookup(key); ok {
 
-				return s.currTx.operations[i].value, nil
+			// false means key was deleted in the transaction
+			if false == op.isWrite || op.expired(s.now()) {
+				return entry{}, false
 			}
+
+			return entry{value: op.value, expireAt: op.expireAt}, true
 		}
 
 		currentTx = currentTx.parent
 	}
 
 	// the key is not in the transactions. Check the kv
-	v, ok := s.kv[key]
-	if ok {
-		return v, nil
+	e, ok := s.kv[key]
+	if ok && !e.expired(s.now()) {
+		return e, true
+	}
+
+	return entry{}, false
+}
+
+// eq returns true if the keys key1 and key2 exist and their values are
+// equal. A missing key is not an error: eq returns false.
+func (s *Store) eq(key1, key2 string) bool {
+	v1, err := s.read(key1)
+	if err != nil {
+		return false
+	}
+
+	v2, err := s.read(key2)
+	if err != nil {
+		return false
+	}
+
+	return v1 == v2
+}
+
+// assert checks that the value of the key is expected.
+//
+// assert returns ErrAssertionFailed, with the actual and expected values, if
+// the value differs or the key does not exist.
+func (s *Store) assert(key, expected string) error {
+	v, err := s.read(key)
+	if err != nil {
+		return fmt.Errorf("%w: %s: key not found, want %q", ErrAssertionFailed, key, expected)
+	}
+
+	if v != expected {
+		return fmt.Errorf("%w: %s: got %q, want %q", ErrAssertionFailed, key, v, expected)
+	}
+
+	return nil
+}
+
+// verify returns true if the SHA-256 digest of the value of the key, hex
+// encoded, is digest. The comparison ignores the case of digest.
+//
+// verify returns error if the key does not exist.
+func (s *Store) verify(key, digest string) (bool, error) {
+	v, err := s.read(key)
+	if err != nil {
+		return false, err
 	}
 
-	return "", fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:]) == strings.ToLower(digest), nil
+}
+
+// StoreHash returns the SHA-256 digest, hex encoded, of the committed keys
+// and their values, in key order. Each key and value is prefixed with its
+// length, so different keyspaces never hash the same bytes. Stores with the
+// same committed data have the same hash, whatever the order of the writes.
+// Open transactions, notes and expired keys are not part of the hash.
+func (s *Store) StoreHash() string {
+	now := s.now()
+	keys := make([]string, 0, len(s.kv))
+	for k, e := range s.kv {
+		if !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		v := s.kv[k].value
+		fmt.Fprintf(h, "%d:%s%d:%s", len(k), k, len(v), v)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeEnv writes the value of the environment variable name to the key.
+//
+// writeEnv returns ErrEnvNotSet if the variable is not set.
+func (s *Store) writeEnv(key, name string) error {
+	v, ok := s.lookupEnv(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrEnvNotSet, name)
+	}
+
+	return s.write(key, v)
 }
 
 // remove removes the key from the kvStore, or marks the key for removal in the
 // current transaction.
 //
-// remove returns error if the key does not exist.
+// remove returns error if the key does not exist, unless the remove is
+// lenient.
 func (s *Store) remove(key string) error {
+	s.metrics.removes++
 
 	_, err := s.read(key)
+	if err != nil && s.lenientRemove {
+		return nil
+	}
+
 	if err != nil {
 		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
 	}
 
-	s.modify(operation{key: key, isWrite: false})
-	return nil
+	return s.modify(operation{key: key, isWrite: false})
 }
 
 // commit applies all operations of the curent transaction to the parent
@@ -189,27 +1101,39 @@ func (s *Store) commit() error {
 		return ErrNoCurrentTransation
 	}
 
-	// 1) append to parent
-	for _, op := range s.currTx.operations {
-		s.currTx.parent.operations = append(s.currTx.parent.operations, operation{key: op.key, value: op.value, isWrite: op.isWrite})
+	s.metrics.commits++
+	start := s.now()
+
+	// 1) append to parent, only the effective operations
+	for _, op := range compact(s.currTx.operations) {
+		s.currTx.parent.add(op)
 	}
 
 	// 2) delete/sustitute current
 	s.currTx = s.currTx.parent
+	if !s.currTx.isRoot() {
+		s.maybeCompact(s.currTx)
+	}
 
 	// 3) if new current parent is root and has operations is, apply them
-    // sequentially. No intend is made to optimize the operations. F. ex, only
-    // apply the last write for each key.
+	// sequentially. They were compacted in step 1, so for each key only its
+	// last remove, the last write of the value and the last write of the note
+	// after it are applied.
+	//
+	// The root only receives operations in step 1, from a commit of the
+	// outermost transaction, so they never outlive this commit.
+	var err error
 	if s.currTx.isRoot() && s.currTx.hasOperations() {
-		for _, op := range s.currTx.operations {
-			s.kv.modify(op)
-		}
+		s.logger.Infof("%s: applying %d operations", Commit, len(s.currTx.operations))
+		err = s.applyRoot(s.currTx)
+	}
 
-		// delete the operations, as they are now in the kvStore
-		s.currTx.operations = nil
+	if s.currTx.isRoot() {
+		s.metrics.recordCommit(s.now().Sub(start))
 	}
 
-	return nil
+	s.logTx(Commit)
+	return err
 }
 
 // discard discards the current transaction. All operations in the current
@@ -220,10 +1144,419 @@ func (s *Store) discard() {
 		return
 	}
 
+	s.metrics.discards++
+	s.metrics.discardedOps += uint64(len(s.currTx.operations))
+
+	discarded := s.currTx
 	s.currTx = s.currTx.parent
+	s.forgetDiscarded(discarded.operations)
+	s.logTx(Discard)
+}
+
+// flatten folds all open transactions into the outermost one, as if each
+// were committed to its parent, except the outermost. A single commit then
+// applies all the operations, and a single discard abandons them.
+func (s *Store) flatten() {
+	levels := s.levels()
+	if len(levels) < 2 {
+		return
+	}
+
+	outermost := levels[0]
+	for _, t := range levels[1:] {
+		for _, op := range compact(t.operations) {
+			outermost.add(op)
+		}
+		for k := range t.touched {
+			if outermost.touched == nil {
+				outermost.touched = make(map[string]bool)
+			}
+			outermost.touched[k] = true
+		}
+	}
+
+	s.currTx = outermost
+	s.maybeCompact(s.currTx)
+	s.logTx(Flatten)
 }
 
 // begin initiates a transaction.
 func (s *Store) begin() {
 	s.currTx = &tx{parent: s.currTx}
+	s.logTx(Begin)
+}
+
+// txKeys returns the sorted keys written or removed in any of the open
+// transactions, one per line. At root txKeys returns an empty string.
+func (s *Store) txKeys() string {
+	seen := make(map[string]bool)
+	var keys []string
+	for t := s.currTx; !t.isRoot(); t = t.parent {
+		for _, op := range t.operations {
+			if !seen[op.key] {
+				seen[op.key] = true
+				keys = append(keys, op.key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	return strings.Join(keys, "\n")
+}
+
+// setEx writes the value and the key to the Store like write, but the key
+// expires after the given number of seconds. The expiration is part of the
+// write operation: discarding the write also discards the expiration.
+//
+// setEx returns error if seconds is not a positive integer.
+func (s *Store) setEx(key, seconds, value string) error {
+	n, err := IntArg("seconds", seconds, 1)
+	if err != nil {
+		return err
+	}
+
+	s.metrics.writes++
+	expireAt := s.now().Add(time.Duration(n) * time.Second)
+	return s.modify(operation{key: key, value: value, isWrite: true, expireAt: expireAt})
+}
+
+// getDel reads the current value of the key key and removes the key. Like
+// remove, the removal is part of the current transaction.
+//
+// getDel returns error if the key does not exist.
+func (s *Store) getDel(key string) (string, error) {
+	s.metrics.reads++
+	s.metrics.removes++
+
+	v, err := s.read(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.modify(operation{key: key, isWrite: false}); err != nil {
+		return "", err
+	}
+
+	return v, nil
+}
+
+// apply applies the operation op to the committed state: notes operations to
+// the notes, any other to the kvStore. Removing a key also removes its note.
+// If the AOF is enabled, the operation is appended to it.
+//
+// apply returns error if the operation can not be appended to the AOF. The
+// operation is applied anyway.
+func (s *Store) apply(op operation) error {
+	op.key = s.normalize(op.key)
+	s.metrics.appliedOps++
+	s.addBloom(op)
+
+	if op.isNote {
+		s.notes[op.key] = op.value
+	} else {
+		s.kv.modify(op)
+		if !op.isWrite {
+			delete(s.notes, op.key)
+			s.forget(op.key)
+		}
+	}
+
+	s.record(op)
+
+	return s.appendAOF(op)
+}
+
+// annotate writes the note of the key key. The note does not affect the value
+// of the key and, like a write, is part of the current transaction.
+//
+// annotate returns error if the key does not exist.
+func (s *Store) annotate(key, note string) error {
+	if _, err := s.read(key); err != nil {
+		return err
+	}
+
+	return s.modify(operation{key: key, value: note, isWrite: true, isNote: true})
+}
+
+// note retrieves the current note of the key key. The note can be on the
+// transaction or already committed. A key without note has an empty note.
+//
+// note returns error if the key does not exist.
+func (s *Store) note(key string) (string, error) {
+	key = s.normalize(key)
+	if _, err := s.read(key); err != nil {
+		return "", err
+	}
+
+	for t := s.currTx; !t.isRoot(); t = t.parent {
+		for i := len(t.operations) - 1; i >= 0; i-- {
+			op := t.operations[i]
+			if op.key != key {
+				continue
+			}
+
+			if op.isNote {
+				return op.value, nil
+			}
+
+			// the key was removed, and its note with it
+			if !op.isWrite {
+				return "", nil
+			}
+		}
+	}
+
+	return s.notes[key], nil
+}
+
+// commitCost returns the number of operations the next commit would append to
+// the parent transaction: the operations of the current transaction without
+// the shadowed ones.
+//
+// commitCost returns error if there is no current transaction.
+func (s *Store) commitCost() (string, error) {
+	if s.currTx.isRoot() {
+		return "", ErrNoCurrentTransation
+	}
+
+	return strconv.Itoa(len(compact(s.currTx.operations))), nil
+}
+
+// compactTx removes the operations of the current transaction shadowed by a
+// later operation on the same key, as a commit would. The operations before
+// the last savepoint are kept. It returns the number of operations removed.
+//
+// compactTx returns error if there is no current transaction.
+func (s *Store) compactTx() (string, error) {
+	if s.currTx.isRoot() {
+		return "", ErrNoCurrentTransation
+	}
+
+	n := len(s.currTx.operations)
+	s.currTx.compactOperations()
+	return strconv.Itoa(n - len(s.currTx.operations)), nil
+}
+
+// applyRoot applies the operations of the root transaction root to the
+// kvStore, in order, and deletes them.
+//
+// All operations are applied even if some can not be persisted. The first
+// error is returned.
+func (s *Store) applyRoot(root *tx) error {
+	var err error
+	for _, op := range root.operations {
+		if applyErr := s.apply(op); applyErr != nil && err == nil {
+			err = applyErr
+		}
+	}
+
+	// delete the operations, as they are now in the kvStore
+	root.operations = nil
+	root.index = nil
+	return err
+}
+
+// flush applies the operations held by the root transaction, if any, to the
+// kvStore. The commits apply them as they reach the root, so the root should
+// never hold operations: flush is a safety valve for the anomaly reported by
+// the check command. It returns the number of operations applied.
+func (s *Store) flush() (int, error) {
+	root := s.currTx
+	for !root.isRoot() {
+		root = root.parent
+	}
+
+	n := len(root.operations)
+	if n > 0 {
+		s.logger.Infof("%s: applying %d operations", Flush, n)
+	}
+
+	return n, s.applyRoot(root)
+}
+
+// integrityCheck walks the transaction chain and returns the description of
+// the first anomaly found, or "ok" if there is none. The anomalies are:
+//
+//   - a cycle in the chain, so the root is never reached.
+//   - an operation with an empty key.
+//   - operations in the root: they should have been applied to the kvStore.
+func (s *Store) integrityCheck() string {
+	seen := make(map[*tx]bool)
+	var chain []*tx
+	for t := s.currTx; t != nil; t = t.parent {
+		if seen[t] {
+			return fmt.Sprintf("transaction cycle after %d levels: root not reachable", len(chain))
+		}
+
+		seen[t] = true
+		chain = append(chain, t)
+	}
+
+	// from root, level 0, to the current transaction
+	for level := 0; level < len(chain); level++ {
+		t := chain[len(chain)-1-level]
+		for i, op := range t.operations {
+			if op.key == "" {
+				return fmt.Sprintf("empty key in operation %d of level %d", i, level)
+			}
+		}
+	}
+
+	if root := chain[len(chain)-1]; root.hasOperations() {
+		return fmt.Sprintf("root holds %d operations not applied to the kv", len(root.operations))
+	}
+
+	return "ok"
+}
+
+// keyHistory returns every occurrence of the key key in the Store, one per
+// line: first the committed value, if any, and then the operations of each
+// open transaction, from the outermost to the current one.
+func (s *Store) keyHistory(key string) string {
+	key = s.normalize(key)
+	var lines []string
+	if e, ok := s.kv[key]; ok && !e.expired(s.now()) {
+		lines = append(lines, "[committed] "+e.value)
+	}
+
+	for i, t := range s.levels() {
+		for _, op := range t.operations {
+			if op.key != key {
+				continue
+			}
+
+			switch {
+			case op.isNote:
+				lines = append(lines, fmt.Sprintf("[level %d] annotate %s", i+1, op.value))
+			case op.isWrite:
+				lines = append(lines, fmt.Sprintf("[level %d] write %s", i+1, op.value))
+			default:
+				lines = append(lines, fmt.Sprintf("[level %d] remove", i+1))
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// explain returns the visible value of the key key followed by its source:
+// "(kv)" for the committed value, or "(tx level N)" for the transaction that
+// wrote it, the outermost being level 1. Like read, the innermost write or
+// remove shadows the outer ones.
+//
+// explain returns error if the key does not exist, and the level of the
+// transaction that removed it, if any.
+func (s *Store) explain(key string) (string, error) {
+	key = s.normalize(key)
+	now := s.now()
+	level := s.depth()
+	for t := s.currTx; !t.isRoot(); t = t.parent {
+		if op, ok := t.lookup(key); ok {
+			if !op.isWrite || op.expired(now) {
+				return "", fmt.Errorf("%w: %s (removed in tx level %d)", ErrKeyNotFound, key, level)
+			}
+
+			return fmt.Sprintf("%s (tx level %d)", op.value, level), nil
+		}
+
+		level--
+	}
+
+	e, ok := s.kv[key]
+	if !ok || e.expired(now) {
+		return "", fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	return e.value + " (kv)", nil
+}
+
+// txSizes returns the number of operations of each transaction level, one
+// "level N: count" per line, from the root, level 0, to the current one.
+func (s *Store) txSizes() string {
+	root := s.currTx
+	for !root.isRoot() {
+		root = root.parent
+	}
+
+	lines := []string{fmt.Sprintf("level 0: %d", len(root.operations))}
+	for i, t := range s.levels() {
+		lines = append(lines, fmt.Sprintf("level %d: %d", i+1, len(t.operations)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// resetTx discards all open transactions, leaving the committed data
+// untouched. It returns the number of transactions discarded.
+func (s *Store) resetTx() int {
+	n := 0
+	for !s.currTx.isRoot() {
+		s.discard()
+		n++
+	}
+
+	return n
+}
+
+// dirty returns true if any open transaction has operations, so a commit of
+// all the transactions would change the committed data.
+func (s *Store) dirty() bool {
+	for _, t := range s.levels() {
+		if t.hasOperations() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readAll returns the effective keyspace as a JSON object of the keys and
+// their values.
+func (s *Store) readAll() (string, error) {
+	b, err := json.Marshal(s.view())
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// countValues returns the number of distinct values of the effective
+// keyspace.
+func (s *Store) countValues() int {
+	distinct := make(map[string]bool)
+	for _, v := range s.view() {
+		distinct[v] = true
+	}
+
+	return len(distinct)
+}
+
+// view returns the effective keyspace: the value of every key as seen from
+// the current transaction. The committed values are overridden by the
+// operations of the open transactions, from the outermost to the current
+// one. Expired keys are not part of the view.
+func (s *Store) view() map[string]string {
+	now := s.now()
+	view := make(map[string]string, len(s.kv))
+	for k, e := range s.kv {
+		if !e.expired(now) {
+			view[k] = e.value
+		}
+	}
+
+	for _, t := range s.levels() {
+		for _, op := range t.operations {
+			switch {
+			case op.isNote:
+				continue
+			case !op.isWrite || op.expired(now):
+				delete(view, op.key)
+			default:
+				view[op.key] = op.value
+			}
+		}
+	}
+
+	return view
 }
@@ -1,10 +1,15 @@
 package storage_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"testing"
 	"github.com/caasmo/kv-repl-barebones/storage"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
 )
 
 type testCase struct {
@@ -13,6 +18,23 @@ type testCase struct {
 	val     string
 	want    string
 	wantErr error
+
+	// args, if not nil, are the arguments of the command instead of key and
+	// val.
+	args []string
+}
+
+// fakeClock is a clock for the Store that only moves when advanced.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
 }
 
 func Example() {
@@ -61,9 +83,18 @@ func Example() {
 }
 
 func test(t *testing.T, cases []testCase) {
-	store := storage.NewStore()
+	testStore(t, storage.NewStore(), cases)
+}
+
+func testStore(t *testing.T, store *storage.Store, cases []testCase) {
+	t.Helper()
 	for _, tc := range cases {
-		v, err := store.Process(tc.cmd, tc.key, tc.val)
+		args := tc.args
+		if args == nil {
+			args = []string{tc.key, tc.val}
+		}
+
+		v, err := store.Process(tc.cmd, args...)
 		if v != tc.want {
 			t.Errorf("\nGot value '%s' want '%s'", v, tc.want)
 		}
@@ -196,3 +227,1046 @@ func TestReadErrorAfterRemoveInTransaction(t *testing.T) {
 
 	test(t, cases)
 }
+
+func TestDebug(t *testing.T) {
+	var buf bytes.Buffer
+	store := storage.NewStore(storage.WithDebug(&buf))
+
+	cmds := [][]string{
+		{"begin", "", ""},
+		{"write", "a", "hi"},
+		{"begin", "", ""},
+		{"write", "b", "bye"},
+		{"commit", "", ""},
+		{"commit", "", ""},
+		{"discard", "", ""},
+	}
+
+	for _, c := range cmds {
+		if _, err := store.Process(c[0], c[1], c[2]); err != nil {
+			t.Fatalf("\nGot Error '%s' want 'nil'", err)
+		}
+	}
+
+	want := "begin: depth=1 ops=0\n" +
+		"begin: depth=2 ops=0\n" +
+		"commit: depth=1 ops=2\n" +
+		"commit: depth=0 ops=0\n"
+
+	if buf.String() != want {
+		t.Errorf("\nGot debug output '%s' want '%s'", buf.String(), want)
+	}
+}
+
+func TestTxKeys(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "z", val: "root", want: "", wantErr: nil},
+		{cmd: "txkeys", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "remove", key: "z", val: "", want: "", wantErr: nil},
+		{cmd: "txkeys", key: "", val: "", want: "a\nb\nz", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "txkeys", key: "", val: "", want: "a\nb", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "txkeys", key: "", val: "", want: "", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestSetEx(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	store := storage.NewStore(storage.WithClock(clock.now))
+
+	testStore(t, store, []testCase{
+		{cmd: "setex", args: []string{"a", "10", "hi"}, want: "", wantErr: nil},
+		{cmd: "setex", args: []string{"b", "0", "hi"}, want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "setex", args: []string{"b", "ten", "hi"}, want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+	})
+
+	clock.advance(9 * time.Second)
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+	})
+
+	clock.advance(time.Second)
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestSetExInTransaction(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	store := storage.NewStore(storage.WithClock(clock.now))
+
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "setex", args: []string{"a", "10", "bye"}, want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "bye", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "setex", args: []string{"b", "10", "bye"}, want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	// the discarded write took its expiration with it. The committed one
+	// expires.
+	clock.advance(10 * time.Second)
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestGetDel(t *testing.T) {
+	cases := []testCase{
+		{cmd: "getdel", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "getdel", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "bye", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "getdel", key: "a", val: "", want: "bye", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "bye", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestNotes(t *testing.T) {
+	cases := []testCase{
+		{cmd: "annotate", key: "a", val: "first", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "first", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "first", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "first", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "second", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "bye", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "second", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "first", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestNotesRemovedWithKey(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "first", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "second", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestCommitCost(t *testing.T) {
+	store := storage.NewStore()
+
+	testStore(t, store, []testCase{
+		{cmd: "commitcost", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+		{cmd: "annotate", key: "c", val: "note", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "x", val: "parent", want: "", wantErr: nil},
+	})
+
+	before := storage.TxOperations(store)
+	testStore(t, store, []testCase{
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commitcost", key: "", val: "", want: "0", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "3", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "1", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "annotate", key: "c", val: "other", want: "", wantErr: nil},
+		{cmd: "remove", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "bye", want: "", wantErr: nil},
+		// a: last write. b: remove. c: remove and write.
+		{cmd: "commitcost", key: "", val: "", want: "4", wantErr: nil},
+	})
+
+	testStore(t, store, []testCase{
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	if appended := storage.TxOperations(store) - before; appended != 4 {
+		t.Errorf("\nGot %d operations appended to parent want 4", appended)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "3", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "bye", wantErr: nil},
+		{cmd: "note", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "x", val: "", want: "parent", wantErr: nil},
+	})
+}
+
+func TestTxRequired(t *testing.T) {
+	patch := writeFile(t, t.TempDir(), "changes.patch", "+c 1\n")
+	store := storage.NewStore(storage.WithTxRequired())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "bye", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "setex", args: []string{"a", "10", "hi"}, want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "getdel", key: "b", val: "", want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "renameprefix", args: []string{"a", "c"}, want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "copyprefix", args: []string{"a", "c"}, want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "deletematching", key: "hi", val: "", want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "patch", key: patch, val: "", want: "", wantErr: storage.ErrNoTransaction},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "bye", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestNoShadowing(t *testing.T) {
+	store := storage.NewStore(storage.WithNoShadowing())
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi again", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "one", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "two", want: "", wantErr: storage.ErrDuplicateKeyInTx},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: storage.ErrDuplicateKeyInTx},
+		{cmd: "getdel", key: "a", val: "", want: "", wantErr: storage.ErrDuplicateKeyInTx},
+		{cmd: "read", key: "a", val: "", want: "one", wantErr: nil},
+		{cmd: "write", key: "b", val: "one", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "nested", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "setex", args: []string{"b", "10", "nested"}, want: "", wantErr: storage.ErrDuplicateKeyInTx},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "nested", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "new tx", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "new tx", wantErr: nil},
+	})
+}
+
+func TestAutoCommit(t *testing.T) {
+	cases := []testCase{
+		{cmd: "autocommit", key: "maybe", val: "", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "autocommit", key: "off", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "write", key: "a", val: "buffered", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "buffered", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "buffered", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "committed", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b", val: "", want: "committed", wantErr: nil},
+		// explicit transactions are not affected
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "read", key: "c", val: "", want: "hi", wantErr: nil},
+		{cmd: "autocommit", key: "on", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "hi", want: "", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "hi", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestLenientRemove(t *testing.T) {
+	stores := []struct {
+		name    string
+		opts    []storage.Option
+		wantErr error
+	}{
+		{name: "strict", opts: nil, wantErr: storage.ErrKeyNotFound},
+		{name: "lenient", opts: []storage.Option{storage.WithLenientRemove()}, wantErr: nil},
+	}
+
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			store := storage.NewStore(s.opts...)
+			testStore(t, store, []testCase{
+				{cmd: "remove", key: "a", val: "", want: "", wantErr: s.wantErr},
+				{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+				{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+				{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+				{cmd: "remove", key: "a", val: "", want: "", wantErr: s.wantErr},
+				{cmd: "txkeys", key: "", val: "", want: "a", wantErr: nil},
+				{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+				{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+				{cmd: "getdel", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+			})
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	test(t, []testCase{
+		{cmd: "explain", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "committed", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "committed", want: "", wantErr: nil},
+		{cmd: "explain", key: "a", val: "", want: "committed (kv)", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "one", want: "", wantErr: nil},
+		{cmd: "annotate", key: "b", val: "note", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "three", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "explain", key: "a", val: "", want: "three (tx level 3)", wantErr: nil},
+		{cmd: "explain", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "explain", key: "a", val: "", want: "one (tx level 1)", wantErr: nil},
+		// notes do not shadow the value
+		{cmd: "explain", key: "b", val: "", want: "committed (kv)", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "explain", key: "a", val: "", want: "one (kv)", wantErr: nil},
+	})
+
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	if _, err := store.Process("explain", "a"); err == nil || err.Error() != "Key not found: a (removed in tx level 2)" {
+		t.Errorf("\nGot Error '%v' want the removing level", err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	store := storage.NewStore()
+	storage.AppendRootOperation(store, "a", "hi")
+	storage.AppendRootOperation(store, "b", "hi")
+	testStore(t, store, []testCase{
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "pending", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "flush", key: "", val: "", want: "2", wantErr: nil},
+		{cmd: "check", key: "", val: "", want: "ok", wantErr: nil},
+		{cmd: "flush", key: "", val: "", want: "0", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		// the flushed operations are committed, unlike the transaction
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestNoPendingRootOperations(t *testing.T) {
+	test(t, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "2", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "1", want: "", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "1", want: "", wantErr: nil},
+		{cmd: "flatten", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "autocommit", key: "off", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "1", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "txsizes", key: "", val: "", want: "level 0: 0", wantErr: nil},
+		{cmd: "check", key: "", val: "", want: "ok", wantErr: nil},
+		{cmd: "flush", key: "", val: "", want: "0", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "1", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "1", wantErr: nil},
+	})
+}
+
+func TestMaxKeys(t *testing.T) {
+	store := storage.NewStore(storage.WithMaxKeys(2))
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: storage.ErrMaxKeysExceeded},
+		{cmd: "setex", args: []string{"c", "10", "hi"}, want: "", wantErr: storage.ErrMaxKeysExceeded},
+		{cmd: "write", key: "a", val: "overwritten", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "hi", wantErr: nil},
+		// the effective keyspace of the transaction is counted
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "hi", want: "", wantErr: storage.ErrMaxKeysExceeded},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "e", val: "hi", want: "", wantErr: storage.ErrMaxKeysExceeded},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "hi", want: "", wantErr: storage.ErrMaxKeysExceeded},
+		{cmd: "read", key: "a", val: "", want: "overwritten", wantErr: nil},
+	})
+}
+
+func TestIntegrityCheck(t *testing.T) {
+	test(t, []testCase{
+		{cmd: "check", key: "", val: "", want: "ok", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "check", key: "", val: "", want: "ok", wantErr: nil},
+		{cmd: "write", key: "", val: "hi", want: "", wantErr: nil},
+		{cmd: "check", key: "", val: "", want: "empty key in operation 1 of level 2", wantErr: nil},
+	})
+
+	rootOps := storage.NewStore()
+	storage.AppendRootOperation(rootOps, "a", "hi")
+	testStore(t, rootOps, []testCase{
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "check", key: "", val: "", want: "root holds 1 operations not applied to the kv", wantErr: nil},
+	})
+
+	cycle := storage.NewStore()
+	testStore(t, cycle, []testCase{
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+	})
+	storage.MakeTxCycle(cycle)
+	testStore(t, cycle, []testCase{
+		{cmd: "check", key: "", val: "", want: "transaction cycle after 1 levels: root not reachable", wantErr: nil},
+	})
+}
+
+func TestFlushThreshold(t *testing.T) {
+	var cases []testCase
+	for i := 0; i < 20; i++ {
+		cases = append(cases,
+			testCase{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+			testCase{cmd: "write", key: "a", val: fmt.Sprint(i), want: "", wantErr: nil},
+			testCase{cmd: "write", key: fmt.Sprint("k", i%3), val: fmt.Sprint(i), want: "", wantErr: nil},
+			testCase{cmd: "annotate", key: "a", val: fmt.Sprint("note", i), want: "", wantErr: nil},
+		)
+
+		if i%4 == 0 {
+			cases = append(cases, testCase{cmd: "remove", key: "a", val: "", want: "", wantErr: nil})
+		}
+
+		if i%5 == 0 {
+			cases = append(cases, testCase{cmd: "discard", key: "", val: "", want: "", wantErr: nil})
+		} else {
+			cases = append(cases, testCase{cmd: "commit", key: "", val: "", want: "", wantErr: nil})
+		}
+	}
+
+	// stays inside the outer transactions
+	eager := storage.NewStore(storage.WithFlushThreshold(2))
+	lazy := storage.NewStore()
+	testStore(t, eager, append([]testCase{{cmd: "begin", key: "", val: "", want: "", wantErr: nil}}, cases...))
+	testStore(t, lazy, append([]testCase{{cmd: "begin", key: "", val: "", want: "", wantErr: nil}}, cases...))
+
+	if e, l := storage.TxOperations(eager), storage.TxOperations(lazy); e >= l {
+		t.Errorf("\nGot %d operations with eager compaction want less than %d", e, l)
+	}
+
+	final := []testCase{
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "19", wantErr: nil},
+		{cmd: "note", key: "a", val: "", want: "note19", wantErr: nil},
+		{cmd: "read", key: "k0", val: "", want: "18", wantErr: nil},
+		{cmd: "read", key: "k1", val: "", want: "19", wantErr: nil},
+		{cmd: "read", key: "k2", val: "", want: "17", wantErr: nil},
+	}
+
+	testStore(t, eager, final)
+	testStore(t, lazy, final)
+}
+
+func TestKeyHistory(t *testing.T) {
+	cases := []testCase{
+		{cmd: "keyhistory", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "one", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "other", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "three", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "keyhistory", key: "a", val: "", want: "[committed] hi\n" +
+			"[level 1] write one\n" +
+			"[level 1] remove\n" +
+			"[level 3] write three\n" +
+			"[level 3] annotate note", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestResetTx(t *testing.T) {
+	cases := []testCase{
+		{cmd: "resettx", key: "", val: "", want: "0", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "one", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "two", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "resettx", key: "", val: "", want: "3", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hi", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "resettx", key: "", val: "", want: "0", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestCompact(t *testing.T) {
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "compact", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "compact", key: "", val: "", want: "0", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "3", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "1", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "annotate", key: "c", val: "other", want: "", wantErr: nil},
+		{cmd: "remove", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "bye", want: "", wantErr: nil},
+		{cmd: "remove", key: "d", val: "", want: "", wantErr: nil},
+		// a: last write. b: remove. c: remove and write. d: remove.
+		{cmd: "compact", key: "", val: "", want: "4", wantErr: nil},
+	})
+
+	if got := storage.TxOperations(store); got != 5 {
+		t.Errorf("\nGot %d operations after compact want 5", got)
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "compact", key: "", val: "", want: "0", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "3", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "bye", wantErr: nil},
+		{cmd: "note", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "3", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "bye", wantErr: nil},
+		{cmd: "read", key: "d", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestDirty(t *testing.T) {
+	cases := []testCase{
+		{cmd: "dirty", key: "", val: "", want: "false", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "dirty", key: "", val: "", want: "false", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "dirty", key: "", val: "", want: "false", wantErr: nil},
+		{cmd: "write", key: "a", val: "one", want: "", wantErr: nil},
+		{cmd: "dirty", key: "", val: "", want: "true", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "dirty", key: "", val: "", want: "true", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "dirty", key: "", val: "", want: "true", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "dirty", key: "", val: "", want: "false", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "dirty", key: "", val: "", want: "true", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "dirty", key: "", val: "", want: "false", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestReadAll(t *testing.T) {
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "readall", key: "", val: "", want: "{}", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "bye", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: `"quoted"\key`, val: "line\nbreak <tag>", want: "", wantErr: nil},
+	})
+
+	v, err := store.Process("readall")
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal([]byte(v), &got); err != nil {
+		t.Fatalf("\nGot invalid JSON '%s': %s", v, err)
+	}
+
+	want := map[string]string{"a": "hi", `"quoted"\key`: "line\nbreak <tag>"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\nGot '%v' want '%v'", got, want)
+	}
+}
+
+func TestEq(t *testing.T) {
+	cases := []testCase{
+		{cmd: "eq", key: "a", val: "b", want: "false", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "eq", key: "a", val: "a", want: "true", wantErr: nil},
+		{cmd: "eq", key: "a", val: "b", want: "false", wantErr: nil},
+		{cmd: "eq", key: "b", val: "a", want: "false", wantErr: nil},
+		{cmd: "write", key: "b", val: "bye", want: "", wantErr: nil},
+		{cmd: "eq", key: "a", val: "b", want: "false", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "eq", key: "a", val: "b", want: "true", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "eq", key: "a", val: "b", want: "false", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "eq", key: "a", val: "b", want: "false", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestAssert(t *testing.T) {
+	store := storage.NewStore()
+	testStore(t, store, []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "assert", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "bye", want: "", wantErr: nil},
+		{cmd: "assert", key: "a", val: "bye", want: "", wantErr: nil},
+	})
+
+	errCases := []struct {
+		key, expected string
+		wantMsg       string
+	}{
+		{key: "a", expected: "hi", wantMsg: `Assertion failed: a: got "bye", want "hi"`},
+		{key: "b", expected: "hi", wantMsg: `Assertion failed: b: key not found, want "hi"`},
+	}
+
+	for _, tc := range errCases {
+		_, err := store.Process("assert", tc.key, tc.expected)
+		if !errors.Is(err, storage.ErrAssertionFailed) {
+			t.Fatalf("\nGot Error '%v' want '%s'", err, storage.ErrAssertionFailed)
+		}
+
+		if err.Error() != tc.wantMsg {
+			t.Errorf("\nGot message '%s' want '%s'", err, tc.wantMsg)
+		}
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	nested := []testCase{
+		{cmd: "write", key: "a", val: "committed", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "committed", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "level 1", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "level 1", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "level 2", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "level 3", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+	}
+
+	committed := storage.NewStore()
+	testStore(t, committed, nested)
+	testStore(t, committed, []testCase{
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	flattened := storage.NewStore()
+	testStore(t, flattened, nested)
+	testStore(t, flattened, []testCase{
+		{cmd: "flatten", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b", val: "", want: "level 3", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "level 2", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	})
+
+	want, _ := committed.Process("readall")
+	testStore(t, flattened, []testCase{
+		{cmd: "readall", key: "", val: "", want: want, wantErr: nil},
+	})
+}
+
+func TestFlattenDiscard(t *testing.T) {
+	cases := []testCase{
+		{cmd: "flatten", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "committed", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "flatten", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "level 1", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "level 2", want: "", wantErr: nil},
+		{cmd: "flatten", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "committed", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: storage.ErrNoCurrentTransation},
+	}
+
+	test(t, cases)
+}
+
+func TestVerify(t *testing.T) {
+	// sha256 of "hello" and "bye"
+	hello := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	bye := "b49f425a7e1f9cff3856329ada223f2f9d368f15a00cf48df16ca95986137fe8"
+
+	cases := []testCase{
+		{cmd: "verify", key: "a", val: hello, want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "hello", want: "", wantErr: nil},
+		{cmd: "verify", key: "a", val: hello, want: "true", wantErr: nil},
+		{cmd: "verify", key: "a", val: strings.ToUpper(hello), want: "true", wantErr: nil},
+		{cmd: "verify", key: "a", val: bye, want: "false", wantErr: nil},
+		{cmd: "verify", key: "a", val: "not-hex", want: "false", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "bye", want: "", wantErr: nil},
+		{cmd: "verify", key: "a", val: bye, want: "true", wantErr: nil},
+		{cmd: "verify", key: "a", val: hello, want: "false", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestStoreHash(t *testing.T) {
+	a := storage.NewStore()
+	testStore(t, a, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+	})
+
+	b := storage.NewStore()
+	testStore(t, b, []testCase{
+		{cmd: "write", key: "c", val: "3", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "0", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+	})
+
+	if a.StoreHash() != b.StoreHash() {
+		t.Fatalf("\nGot different hashes '%s' and '%s' for the same data", a.StoreHash(), b.StoreHash())
+	}
+
+	want := a.StoreHash()
+	testStore(t, b, []testCase{
+		{cmd: "storehash", key: "", val: "", want: want, wantErr: nil},
+		// open transactions are not part of the hash.
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "d", val: "4", want: "", wantErr: nil},
+		{cmd: "storehash", key: "", val: "", want: want, wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	if b.StoreHash() == want {
+		t.Errorf("\nGot the same hash '%s' for different data", want)
+	}
+
+	testStore(t, a, []testCase{
+		{cmd: "write", key: "c", val: "4", want: "", wantErr: nil},
+	})
+
+	if a.StoreHash() == want {
+		t.Errorf("\nGot the same hash '%s' for a different value", want)
+	}
+
+	// the separators in the keys and values do not make keyspaces collide.
+	c := storage.NewStore()
+	testStore(t, c, []testCase{
+		{cmd: "write", key: "a=b", val: "c", want: "", wantErr: nil},
+	})
+
+	d := storage.NewStore()
+	testStore(t, d, []testCase{
+		{cmd: "write", key: "a", val: "b=c", want: "", wantErr: nil},
+	})
+
+	e := storage.NewStore()
+	testStore(t, e, []testCase{
+		{cmd: "write", key: "a", val: "1\nb=2", want: "", wantErr: nil},
+	})
+
+	f := storage.NewStore()
+	testStore(t, f, []testCase{
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "2", want: "", wantErr: nil},
+	})
+
+	if c.StoreHash() == d.StoreHash() || e.StoreHash() == f.StoreHash() {
+		t.Errorf("\nGot the same hash for different data")
+	}
+}
+
+func TestTxSizes(t *testing.T) {
+	cases := []testCase{
+		{cmd: "txsizes", key: "", val: "", want: "level 0: 0", wantErr: nil},
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "1", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "1", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "txsizes", key: "", val: "", want: "level 0: 0\nlevel 1: 3\nlevel 2: 0\nlevel 3: 1", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "txsizes", key: "", val: "", want: "level 0: 0\nlevel 1: 3\nlevel 2: 1", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "txsizes", key: "", val: "", want: "level 0: 0", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestWriteEnv(t *testing.T) {
+	env := map[string]string{"TOKEN": "s3cr3t", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	store := storage.NewStore(storage.WithLookupEnv(lookup))
+	testStore(t, store, []testCase{
+		{cmd: "writeenv", key: "a", val: "TOKEN", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "s3cr3t", wantErr: nil},
+		{cmd: "writeenv", key: "b", val: "MISSING", want: "", wantErr: storage.ErrEnvNotSet},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "writeenv", key: "b", val: "EMPTY", want: "", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "writeenv", key: "a", val: "MISSING", want: "", wantErr: storage.ErrEnvNotSet},
+		{cmd: "read", key: "a", val: "", want: "s3cr3t", wantErr: nil},
+	})
+}
+
+func TestCountValues(t *testing.T) {
+	cases := []testCase{
+		{cmd: "countvalues", key: "", val: "", want: "0", wantErr: nil},
+		{cmd: "write", key: "a", val: "x", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "x", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "y", want: "", wantErr: nil},
+		{cmd: "countvalues", key: "", val: "", want: "2", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "countvalues", key: "", val: "", want: "1", wantErr: nil},
+		{cmd: "write", key: "d", val: "z", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "z", want: "", wantErr: nil},
+		{cmd: "countvalues", key: "", val: "", want: "2", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "countvalues", key: "", val: "", want: "2", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestReadOuterTransaction(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "a", val: "hi", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "outer", want: "", wantErr: nil},
+		{cmd: "write", key: "b", val: "outer", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "outer again", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "c", val: "inner", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "outer again", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "outer", wantErr: nil},
+		{cmd: "remove", key: "b", val: "", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "inner", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestInvalidNumericArgument(t *testing.T) {
+	cases := []struct {
+		args    []string
+		wantMsg string
+	}{
+		{args: []string{"setex", "a", "ten", "hi"}, wantMsg: "Invalid argument: seconds ten (integer required)"},
+		{args: []string{"setex", "a", "1.5", "hi"}, wantMsg: "Invalid argument: seconds 1.5 (integer required)"},
+		{args: []string{"setex", "a", "", "hi"}, wantMsg: "Invalid argument: seconds  (integer required)"},
+		{args: []string{"setex", "a", "99999999999999999999", "hi"}, wantMsg: "Invalid argument: seconds 99999999999999999999 (integer required)"},
+		{args: []string{"setex", "a", "-1", "hi"}, wantMsg: "Invalid argument: seconds -1 (minimum 1)"},
+		{args: []string{"setex", "a", "0", "hi"}, wantMsg: "Invalid argument: seconds 0 (minimum 1)"},
+	}
+
+	for _, tc := range cases {
+		store := storage.NewStore()
+		_, err := store.Process(tc.args[0], tc.args[1:]...)
+
+		if !errors.Is(err, storage.ErrInvalidArgument) {
+			t.Errorf("\nGot Error '%s' want '%s'", err, storage.ErrInvalidArgument)
+			continue
+		}
+
+		if err.Error() != tc.wantMsg {
+			t.Errorf("\nGot Error '%s' want '%s'", err, tc.wantMsg)
+		}
+
+		// nothing written
+		if _, err := store.Process("read", tc.args[1]); !errors.Is(err, storage.ErrKeyNotFound) {
+			t.Errorf("\nGot Error '%s' want '%s'", err, storage.ErrKeyNotFound)
+		}
+	}
+}
+
+func TestTombstone(t *testing.T) {
+	test(t, []testCase{
+		{cmd: "write", key: "a", val: "committed", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "rewritten", want: "", wantErr: nil},
+		{cmd: "annotate", key: "a", val: "note", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "rewritten", wantErr: nil},
+		{cmd: "explain", key: "a", val: "", want: "rewritten (tx level 1)", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "nested", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "nested again", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "nested again", wantErr: nil},
+		{cmd: "savepoint", key: "sp", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "compact", key: "", val: "", want: "0", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "rollbackto", key: "sp", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "nested again", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "rewritten", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "a", val: "", want: "", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "flattened", want: "", wantErr: nil},
+		{cmd: "flatten", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "flattened", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "flattened", wantErr: nil},
+	})
+}
+
+// benchmarkRemoveHeavyTx reads keys with a transaction of 10000 removes open,
+// half of them rewritten after the remove.
+func benchmarkRemoveHeavyTx(b *testing.B, key string) {
+	store := storage.NewStore()
+	for i := 0; i < 10000; i++ {
+		store.Process("write", fmt.Sprintf("k%d", i), "v")
+	}
+
+	store.Process("begin")
+	for i := 0; i < 10000; i++ {
+		store.Process("remove", fmt.Sprintf("k%d", i))
+	}
+
+	for i := 0; i < 10000; i += 2 {
+		store.Process("write", fmt.Sprintf("k%d", i), "rewritten")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.Process("read", key)
+	}
+}
+
+func BenchmarkReadRemoved(b *testing.B) {
+	benchmarkRemoveHeavyTx(b, "k1")
+}
+
+func BenchmarkReadRewritten(b *testing.B) {
+	benchmarkRemoveHeavyTx(b, "k0")
+}
+
+func BenchmarkReadUntouched(b *testing.B) {
+	benchmarkRemoveHeavyTx(b, "missing")
+}
+
+// BenchmarkWriteMaxKeys writes new keys to a Store of 10000 keys, with a
+// maximum number of keys far from reached.
+func BenchmarkWriteMaxKeys(b *testing.B) {
+	store := storage.NewStore(storage.WithMaxKeys(1 << 30))
+	for i := 0; i < 10000; i++ {
+		store.Process("write", fmt.Sprintf("k%d", i), "v")
+	}
+
+	store.Process("begin")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.Process("write", fmt.Sprintf("n%d", i), "v")
+	}
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+var ErrTruncatedStream error = errors.New("Stream truncated")
+
+// streamRecord is a committed key in a stream, or the end of the stream if
+// End is true. The end record holds the number of keys streamed.
+type streamRecord struct {
+	Key      string
+	Value    string
+	Note     string
+	ExpireAt int64
+
+	End   bool
+	Count int
+}
+
+// StreamTo writes the committed state of the Store to w, as a gob stream of
+// one record per key, sorted, followed by an end record. Unlike Snapshot, the
+// keys are encoded one at a time, so the whole state is never built in
+// memory. Open transactions are not part of the stream, nor are expired
+// keys.
+func (s *Store) StreamTo(w io.Writer) error {
+	now := s.now()
+	keys := make([]string, 0, len(s.kv))
+	for k, e := range s.kv {
+		if !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	enc := gob.NewEncoder(w)
+	for _, k := range keys {
+		e := s.kv[k]
+		r := streamRecord{Key: k, Value: e.value, Note: s.notes[k]}
+		if !e.expireAt.IsZero() {
+			r.ExpireAt = e.expireAt.UnixNano()
+		}
+
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	return enc.Encode(streamRecord{End: true, Count: len(keys)})
+}
+
+// LoadStream returns a new Store with the committed state of the stream read
+// from r, as written by StreamTo.
+//
+// LoadStream returns ErrTruncatedStream if r ends before the end record, or
+// if the end record does not match the number of keys read.
+func LoadStream(r io.Reader) (*Store, error) {
+	s := NewStore()
+	dec := gob.NewDecoder(r)
+	for n := 0; ; n++ {
+		var rec streamRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: %d keys read", ErrTruncatedStream, n)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("stream: %w", err)
+		}
+
+		if rec.End {
+			if rec.Count != n {
+				return nil, fmt.Errorf("%w: %d keys read, %d streamed", ErrTruncatedStream, n, rec.Count)
+			}
+
+			return s, nil
+		}
+
+		e := entry{value: rec.Value}
+		if rec.ExpireAt != 0 {
+			e.expireAt = time.Unix(0, rec.ExpireAt)
+		}
+
+		s.kv[rec.Key] = e
+		if rec.Note != "" {
+			s.notes[rec.Key] = rec.Note
+		}
+	}
+}
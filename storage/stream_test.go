@@ -0,0 +1,62 @@
+package storage_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"io"
+	"testing"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	store := storage.NewStore()
+	for i := 0; i < 10000; i++ {
+		store.Process("write", fmt.Sprintf("k%d", i), fmt.Sprintf("value %d", i))
+	}
+
+	testStore(t, store, []testCase{
+		{cmd: "annotate", key: "k1", val: "note", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "uncommitted", val: "hi", want: "", wantErr: nil},
+	})
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(store.StreamTo(pw))
+	}()
+
+	loaded, err := storage.LoadStream(pr)
+	if err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	if got, want := loaded.StoreHash(), store.StoreHash(); got != want {
+		t.Errorf("\nGot hash '%s' want '%s'", got, want)
+	}
+
+	testStore(t, loaded, []testCase{
+		{cmd: "read", key: "k9999", val: "", want: "value 9999", wantErr: nil},
+		{cmd: "note", key: "k1", val: "", want: "note", wantErr: nil},
+		{cmd: "read", key: "uncommitted", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestStreamTruncated(t *testing.T) {
+	store := storage.NewStore()
+	for i := 0; i < 100; i++ {
+		store.Process("write", fmt.Sprintf("k%d", i), "hi")
+	}
+
+	var b bytes.Buffer
+	if err := store.StreamTo(&b); err != nil {
+		t.Fatalf("\nGot Error '%s' want 'nil'", err)
+	}
+
+	for _, n := range []int{0, 10, b.Len() / 2, b.Len() - 1} {
+		_, err := storage.LoadStream(bytes.NewReader(b.Bytes()[:n]))
+		if !errors.Is(err, storage.ErrTruncatedStream) {
+			t.Errorf("\nGot Error '%v' want '%s' (%d of %d bytes)", err, storage.ErrTruncatedStream, n, b.Len())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// defaultSeparator separates the levels of hierarchical keys, like
+// user:1:name, unless configured with WithSeparator.
+const defaultSeparator = ":"
+
+// treeNode is a level of the hierarchy of keys. A node has a value if there
+// is a key ending at it.
+type treeNode struct {
+	children map[string]*treeNode
+	value    string
+	hasValue bool
+}
+
+// child returns the child name of the node n, creating it if needed.
+func (n *treeNode) child(name string) *treeNode {
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+
+	c, ok := n.children[name]
+	if !ok {
+		c = &treeNode{}
+		n.children[name] = c
+	}
+
+	return c
+}
+
+// render writes the children of the node n to b, sorted and indented by
+// depth. Nodes with value are written as name=value.
+func (n *treeNode) render(b *strings.Builder, depth int) {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := n.children[name]
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(name)
+		if c.hasValue {
+			b.WriteString("=")
+			b.WriteString(c.value)
+		}
+		b.WriteString("\n")
+		c.render(b, depth+1)
+	}
+}
+
+// tree returns the effective keyspace as a tree, splitting the keys on the
+// separator of the Store. Each level is indented two spaces deeper than its parent.
+func (s *Store) tree() string {
+	root := &treeNode{}
+	for k, v := range s.view() {
+		n := root
+		for _, name := range strings.Split(k, s.separator) {
+			n = n.child(name)
+		}
+
+		n.value = v
+		n.hasValue = true
+	}
+
+	var b strings.Builder
+	root.render(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
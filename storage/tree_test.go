@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	cases := []testCase{
+		{cmd: "tree", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "user:1:name", val: "Bob", want: "", wantErr: nil},
+		{cmd: "write", key: "user:1:age", val: "42", want: "", wantErr: nil},
+		{cmd: "write", key: "user:2:name", val: "Alice", want: "", wantErr: nil},
+		{cmd: "write", key: "user", val: "all", want: "", wantErr: nil},
+		{cmd: "write", key: "config", val: "on", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "user:2:name", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "user:3:name", val: "Carol", want: "", wantErr: nil},
+		{cmd: "tree", key: "", val: "", want: "config=on\n" +
+			"user=all\n" +
+			"  1\n" +
+			"    age=42\n" +
+			"    name=Bob\n" +
+			"  3\n" +
+			"    name=Carol", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "remove", key: "user", val: "", want: "", wantErr: nil},
+		{cmd: "tree", key: "", val: "", want: "config=on\n" +
+			"user\n" +
+			"  1\n" +
+			"    age=42\n" +
+			"    name=Bob\n" +
+			"  2\n" +
+			"    name=Alice", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestTreeSeparator(t *testing.T) {
+	cases := []testCase{
+		{cmd: "write", key: "user/1/name", val: "Bob", want: "", wantErr: nil},
+		{cmd: "write", key: "user/2/name", val: "Alice", want: "", wantErr: nil},
+		{cmd: "write", key: "user:3", val: "Carol", want: "", wantErr: nil},
+		{cmd: "tree", key: "", val: "", want: "user\n" +
+			"  1\n" +
+			"    name=Bob\n" +
+			"  2\n" +
+			"    name=Alice\n" +
+			"user:3=Carol", wantErr: nil},
+	}
+
+	testStore(t, storage.NewStore(storage.WithSeparator("/")), cases)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// truncate shortens the value of the key to at most n runes, and returns the
+// new value. A value already short enough is not written again. The
+// expiration of the key is kept.
+//
+// truncate returns error if the key does not exist, or if n is not an integer
+// or is negative.
+func (s *Store) truncate(key, n string) (string, error) {
+	limit, err := IntArg("length", n, 0)
+	if err != nil {
+		return "", err
+	}
+
+	e, err := s.readEntry(key)
+	if err != nil {
+		return "", err
+	}
+
+	r := []rune(e.value)
+	if len(r) <= limit {
+		return e.value, nil
+	}
+
+	e.value = string(r[:limit])
+	return e.value, s.writeEntry(key, e)
+}
+
+// replace replaces all the occurrences of old with new in the value of the
+// key, and returns the new value. A value without old is not written again.
+// The expiration of the key is kept.
+//
+// replace returns error if the key does not exist, or if old is empty: it
+// would match between every rune.
+func (s *Store) replace(key, old, new string) (string, error) {
+	if old == "" {
+		return "", fmt.Errorf("%w: old %q (empty)", ErrInvalidArgument, old)
+	}
+
+	e, err := s.readEntry(key)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.Contains(e.value, old) {
+		return e.value, nil
+	}
+
+	e.value = strings.ReplaceAll(e.value, old, new)
+	return e.value, s.writeEntry(key, e)
+}
+
+// transform writes the value of the key transformed by fn, and returns the
+// new value. The expiration of the key is kept.
+//
+// transform returns error if the key does not exist.
+func (s *Store) transform(key string, fn func(string) string) (string, error) {
+	e, err := s.readEntry(key)
+	if err != nil {
+		return "", err
+	}
+
+	e.value = fn(e.value)
+	return e.value, s.writeEntry(key, e)
+}
+
+// reverseRunes returns v with its runes in reverse order.
+func reverseRunes(v string) string {
+	r := []rune(v)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+
+	return string(r)
+}
+
+// inspect describes the value of the key: its length in bytes, whether it is
+// an integer and whether it is valid UTF-8, as "len=5 int=yes utf8=yes".
+//
+// inspect returns error if the key does not exist.
+func (s *Store) inspect(key string) (string, error) {
+	v, err := s.read(key)
+	if err != nil {
+		return "", err
+	}
+
+	_, intErr := strconv.ParseInt(v, 10, 64)
+	return fmt.Sprintf("len=%d int=%s utf8=%s", len(v), yesNo(intErr == nil), yesNo(utf8.ValidString(v))), nil
+}
+
+// yesNo returns "yes" for true and "no" for false.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
@@ -0,0 +1,192 @@
+package storage_test
+
+import (
+	"github.com/caasmo/kv-repl-barebones/storage"
+	"testing"
+	"time"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []testCase{
+		{cmd: "truncate", key: "a", val: "2", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "hello", want: "", wantErr: nil},
+		{cmd: "truncate", key: "a", val: "-1", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "truncate", key: "a", val: "two", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "truncate", key: "a", val: "10", want: "hello", wantErr: nil},
+		{cmd: "truncate", key: "a", val: "5", want: "hello", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "truncate", key: "a", val: "2", want: "he", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "he", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hello", wantErr: nil},
+		{cmd: "write", key: "b", val: "héllo wörld", want: "", wantErr: nil},
+		{cmd: "truncate", key: "b", val: "7", want: "héllo w", wantErr: nil},
+		{cmd: "write", key: "c", val: "日本語", want: "", wantErr: nil},
+		{cmd: "truncate", key: "c", val: "2", want: "日本", wantErr: nil},
+		{cmd: "truncate", key: "c", val: "0", want: "", wantErr: nil},
+		{cmd: "read", key: "c", val: "", want: "", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestValueRewriteKeepsExpiration(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	store := storage.NewStore(storage.WithClock(clock.now))
+
+	testStore(t, store, []testCase{
+		{cmd: "setex", args: []string{"a", "10", "hello"}, want: "", wantErr: nil},
+		{cmd: "truncate", key: "a", val: "4", want: "hell", wantErr: nil},
+		{cmd: "setex", args: []string{"b", "10", "hello"}, want: "", wantErr: nil},
+		{cmd: "replace", args: []string{"b", "l", "L"}, want: "heLLo", wantErr: nil},
+		{cmd: "setex", args: []string{"c", "10", "hello"}, want: "", wantErr: nil},
+		{cmd: "upper", key: "c", val: "", want: "HELLO", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "setex", args: []string{"d", "10", "hello"}, want: "", wantErr: nil},
+		{cmd: "reverse", key: "d", val: "", want: "olleh", wantErr: nil},
+		{cmd: "commit", key: "", val: "", want: "", wantErr: nil},
+	})
+
+	clock.advance(10 * time.Second)
+	testStore(t, store, []testCase{
+		{cmd: "read", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "b", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "c", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "read", key: "d", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+	})
+}
+
+func TestReplace(t *testing.T) {
+	cases := []testCase{
+		{cmd: "replace", args: []string{"a", "l", "L"}, want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "hello", want: "", wantErr: nil},
+		{cmd: "replace", args: []string{"a", "", "L"}, want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "replace", args: []string{"a", "x", "y"}, want: "hello", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "replace", args: []string{"a", "l", "L"}, want: "heLLo", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "heLLo", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hello", wantErr: nil},
+		// occurrences do not overlap: they are replaced from left to right.
+		{cmd: "write", key: "b", val: "aaaa", want: "", wantErr: nil},
+		{cmd: "replace", args: []string{"b", "aa", "b"}, want: "bb", wantErr: nil},
+		{cmd: "write", key: "c", val: "aaa", want: "", wantErr: nil},
+		{cmd: "replace", args: []string{"c", "aa", "ba"}, want: "baa", wantErr: nil},
+		{cmd: "replace", args: []string{"c", "a", "aa"}, want: "baaaa", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestReverse(t *testing.T) {
+	cases := []testCase{
+		{cmd: "reverse", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "hello", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "reverse", key: "a", val: "", want: "olleh", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "olleh", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hello", wantErr: nil},
+		{cmd: "write", key: "b", val: "héllo wörld", want: "", wantErr: nil},
+		{cmd: "reverse", key: "b", val: "", want: "dlröw olléh", wantErr: nil},
+		{cmd: "write", key: "c", val: "日本語", want: "", wantErr: nil},
+		{cmd: "reverse", key: "c", val: "", want: "語本日", wantErr: nil},
+		{cmd: "reverse", key: "c", val: "", want: "日本語", wantErr: nil},
+		{cmd: "write", key: "d", val: "x", want: "", wantErr: nil},
+		{cmd: "reverse", key: "d", val: "", want: "x", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestUpperLower(t *testing.T) {
+	cases := []testCase{
+		{cmd: "upper", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "lower", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "Hello Wörld", want: "", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "upper", key: "a", val: "", want: "HELLO WÖRLD", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "HELLO WÖRLD", wantErr: nil},
+		{cmd: "lower", key: "a", val: "", want: "hello wörld", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "hello wörld", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "Hello Wörld", wantErr: nil},
+		{cmd: "upper", key: "a", val: "", want: "HELLO WÖRLD", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: "HELLO WÖRLD", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestInspect(t *testing.T) {
+	cases := []testCase{
+		{cmd: "inspect", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "write", key: "a", val: "hello", want: "", wantErr: nil},
+		{cmd: "inspect", key: "a", val: "", want: "len=5 int=no utf8=yes", wantErr: nil},
+		{cmd: "write", key: "b", val: "-42", want: "", wantErr: nil},
+		{cmd: "inspect", key: "b", val: "", want: "len=3 int=yes utf8=yes", wantErr: nil},
+		{cmd: "write", key: "c", val: "4.2", want: "", wantErr: nil},
+		{cmd: "inspect", key: "c", val: "", want: "len=3 int=no utf8=yes", wantErr: nil},
+		{cmd: "write", key: "d", val: "日本", want: "", wantErr: nil},
+		{cmd: "inspect", key: "d", val: "", want: "len=6 int=no utf8=yes", wantErr: nil},
+		{cmd: "write", key: "e", val: string([]byte{0xff, 0xfe, 'a'}), want: "", wantErr: nil},
+		{cmd: "inspect", key: "e", val: "", want: "len=3 int=no utf8=no", wantErr: nil},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "write", key: "a", val: "7", want: "", wantErr: nil},
+		{cmd: "inspect", key: "a", val: "", want: "len=1 int=yes utf8=yes", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestHex(t *testing.T) {
+	binary := string([]byte{0x00, 0xff, 'a', 0x00, '\n'})
+	cases := []testCase{
+		{cmd: "readhex", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "writehex", key: "a", val: "00FFa6", want: "", wantErr: nil},
+		{cmd: "readhex", key: "a", val: "", want: "00ffa6", wantErr: nil},
+		{cmd: "writehex", key: "b", val: "00ff61000a", want: "", wantErr: nil},
+		{cmd: "read", key: "b", val: "", want: binary, wantErr: nil},
+		{cmd: "readhex", key: "b", val: "", want: "00ff61000a", wantErr: nil},
+		{cmd: "write", key: "c", val: "hi", want: "", wantErr: nil},
+		{cmd: "readhex", key: "c", val: "", want: "6869", wantErr: nil},
+		{cmd: "writehex", key: "d", val: "", want: "", wantErr: nil},
+		{cmd: "readhex", key: "d", val: "", want: "", wantErr: nil},
+		{cmd: "writehex", key: "e", val: "0g", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "writehex", key: "e", val: "abc", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "read", key: "e", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "writehex", key: "a", val: "00", want: "", wantErr: nil},
+		{cmd: "readhex", key: "a", val: "", want: "00", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "readhex", key: "a", val: "", want: "00ffa6", wantErr: nil},
+	}
+
+	test(t, cases)
+}
+
+func TestB64(t *testing.T) {
+	binary := string([]byte{0x00, 0xff, 'a', 0x00, '\n'})
+	cases := []testCase{
+		{cmd: "readb64", key: "a", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "writeb64", key: "a", val: "AP9hAAo=", want: "", wantErr: nil},
+		{cmd: "read", key: "a", val: "", want: binary, wantErr: nil},
+		{cmd: "readb64", key: "a", val: "", want: "AP9hAAo=", wantErr: nil},
+		{cmd: "readhex", key: "a", val: "", want: "00ff61000a", wantErr: nil},
+		{cmd: "write", key: "b", val: "hi", want: "", wantErr: nil},
+		{cmd: "readb64", key: "b", val: "", want: "aGk=", wantErr: nil},
+		{cmd: "writeb64", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "readb64", key: "c", val: "", want: "", wantErr: nil},
+		{cmd: "writeb64", key: "d", val: "aGk", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "writeb64", key: "d", val: "a*k=", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "writeb64", key: "d", val: "aG-_", want: "", wantErr: storage.ErrInvalidArgument},
+		{cmd: "read", key: "d", val: "", want: "", wantErr: storage.ErrKeyNotFound},
+		{cmd: "begin", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "writeb64", key: "a", val: "AA==", want: "", wantErr: nil},
+		{cmd: "readb64", key: "a", val: "", want: "AA==", wantErr: nil},
+		{cmd: "discard", key: "", val: "", want: "", wantErr: nil},
+		{cmd: "readb64", key: "a", val: "", want: "AP9hAAo=", wantErr: nil},
+	}
+
+	test(t, cases)
+}